@@ -2,13 +2,15 @@ package main
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
-	"encoding/gob"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,6 +18,7 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/jonathangjertsen/toyboy/model"
 	"github.com/jonathangjertsen/toyboy/plugin"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 //go:generate go-enum --marshal --flag --values --nocomments
@@ -34,6 +37,7 @@ import (
 // Clock = 10
 // ExecutionLog = 11
 // Cartridge = 12
+// Breakpoints = 13
 // )
 type DataID uint8
 
@@ -55,6 +59,30 @@ type App struct {
 	GBMu             sync.Mutex
 	ClockMeasurement plugin.ClockMeasurement
 	GBFPSMeasurement plugin.ClockMeasurement
+
+	// Only accessed from the clock's goroutine
+	frameDump *model.FrameDump
+	traceFile *os.File
+
+	serialPeer model.SerialPeer
+	gdb        *model.GDBServer
+
+	// Only accessed from the clock's goroutine
+	snapshots *model.Snapshots
+	movie     *model.Movie
+	moviePath string
+	movieEnd  uint
+
+	// Set while a movie plays back, until its last input has been applied
+	moviePlaying atomic.Bool
+	// Battery save path while it's turned off by a movie, until a save state is loaded
+	movieBatteryPath string
+
+	// Hold-to-rewind
+	rewindMu     sync.Mutex
+	rewindStop   chan struct{}
+	rewindDone   chan struct{}
+	rewindResume bool
 }
 
 func NewApp(config *Config) *App {
@@ -78,6 +106,19 @@ func NewApp(config *Config) *App {
 		CLK:             model.NewClock(),
 	}
 	app.ClockMeasurement.SetCounter(&app.CLK.Cycle)
+	app.CLK.AttachRumbleListener(app.onRumble)
+	app.CLK.AttachFrameListener(app.onFrame)
+	if config.RewindSnapshots == 0 {
+		config.RewindSnapshots = DefaultConfig.RewindSnapshots
+	}
+	app.snapshots = model.NewSnapshots(config.RewindSnapshots, config.RewindInterval)
+	app.CLK.AttachInputListener(app.onInput)
+	if peer, err := model.NewSerialPeer(config.LinkCable); err != nil {
+		fmt.Printf("link cable disabled: %v\n", err)
+	} else {
+		app.CLK.SetSerialPeer(peer)
+		app.serialPeer = peer
+	}
 	app.GBAudio = &model.AudioNN{
 		SampleInterval: time.Second / 44100,
 		SampleBuffers:  model.NewSampleBuffers(1024),
@@ -98,9 +139,45 @@ func (app *App) startup(ctx context.Context) {
 	if err := model.LoadROM(app.config.ROMLocation, &gb); err != nil {
 		panic(err)
 	}
+	if app.config.Model.BootROM.Skip {
+		gb.SkipBootROM()
+	}
+	if app.config.RecordMovie != "" {
+		app.movie = gb.NewMovieFromPowerOn(gb.BootROMLock.BootOff, time.Now())
+		app.moviePath = app.config.RecordMovie
+	}
+	symbolsLocation := app.config.SymbolsLocation
+	if symbolsLocation == "" {
+		symbolsLocation = model.SymbolsPath(app.config.ROMLocation)
+	}
+	if syms, err := model.LoadSymbols(symbolsLocation); err == nil {
+		gb.Debug.Symbols = syms
+	} else if app.config.SymbolsLocation != "" || !errors.Is(err, fs.ErrNotExist) {
+		fmt.Printf("symbols: %v\n", err)
+	}
+	if err := app.snapshots.Take(&gb, app.CLK); err != nil {
+		fmt.Printf("rewind: %v\n", err)
+	}
+
+	if trace := app.config.Model.Debug.Trace; trace != "" {
+		if f, err := os.Create(trace); err != nil {
+			fmt.Printf("trace: %v\n", err)
+		} else {
+			app.traceFile = f
+			app.CLK.SetTrace(f)
+		}
+	}
 
 	app.startGB(&gb)
+	if app.config.GDB != "" {
+		if gdb, err := model.ListenGDB(app.config.GDB, app.GB, app.CLK); err != nil {
+			fmt.Printf("GDB server disabled: %v\n", err)
+		} else {
+			app.gdb = gdb
+		}
+	}
 	app.startWebSocketServer()
+	go app.flushBatteryPeriodically()
 }
 
 func (app *App) domReady(ctx context.Context) {
@@ -112,6 +189,43 @@ func (app *App) beforeClose(ctx context.Context) (prevent bool) {
 }
 
 func (app *App) shutdown(ctx context.Context) {
+	var recording bool
+	app.CLK.Sync(func() {
+		recording = app.movie != nil
+	})
+	if recording {
+		if err := app.StopMovieRecording(); err != nil {
+			fmt.Printf("movie: %v\n", err)
+		}
+	}
+	app.CLK.Sync(func() {
+		if err := app.GB.SaveBattery(); err != nil {
+			fmt.Printf("battery save failed: %v\n", err)
+		}
+	})
+	if err := app.SetTrace(""); err != nil {
+		fmt.Printf("trace: %v\n", err)
+	}
+	if closer, ok := app.serialPeer.(io.Closer); ok {
+		closer.Close()
+	}
+	if app.gdb != nil {
+		app.gdb.Close()
+	}
+}
+
+// How often cartridge RAM is written to disk after the game has modified it
+const BatteryFlushInterval = 5 * time.Second
+
+func (app *App) flushBatteryPeriodically() {
+	ticker := time.NewTicker(BatteryFlushInterval)
+	for range ticker.C {
+		app.CLK.Sync(func() {
+			if err := app.GB.FlushBattery(); err != nil {
+				fmt.Printf("battery save failed: %v\n", err)
+			}
+		})
+	}
 }
 
 func (app *App) startGB(gb *model.Gameboy) {
@@ -122,6 +236,97 @@ func (app *App) startGB(gb *model.Gameboy) {
 	app.Start()
 }
 
+// Forwards the rumble motor state to the frontend as a "rumble" event
+func (app *App) onRumble(on bool) {
+	if app.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(app.ctx, "rumble", on)
+}
+
+// Saves the current frame to a PNG file
+func (app *App) Screenshot(path string) error {
+	var err error
+	app.CLK.Sync(func() {
+		err = app.GB.PPU.FBViewport.SavePNG(path, model.RGBA)
+	})
+	return err
+}
+
+// Starts writing every Nth frame (0 = none) and the listed frame numbers to PNG files in dir
+func (app *App) StartFrameDump(dir string, every uint, frames []uint) error {
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return fmt.Errorf("creating frame dump directory: %w", err)
+	}
+	app.CLK.Sync(func() {
+		app.frameDump = &model.FrameDump{
+			Dir:     dir,
+			Palette: model.RGBA,
+			Every:   every,
+			Frames:  frames,
+		}
+	})
+	return nil
+}
+
+// Stops the frame dump, returning the first error that occurred while dumping
+func (app *App) StopFrameDump() error {
+	var err error
+	app.CLK.Sync(func() {
+		if app.frameDump != nil {
+			err = app.frameDump.Err
+		}
+		app.frameDump = nil
+	})
+	return err
+}
+
+// Starts writing a Gameboy Doctor trace line per executed instruction to the file at path,
+// or stops tracing if path is empty
+func (app *App) SetTrace(path string) error {
+	var f *os.File
+	if path != "" {
+		var err error
+		if f, err = os.Create(path); err != nil {
+			return err
+		}
+	}
+	var err error
+	app.CLK.Sync(func() {
+		if f == nil {
+			err = app.CLK.SetTrace(nil)
+		} else {
+			err = app.CLK.SetTrace(f)
+		}
+		if app.traceFile != nil {
+			if cerr := app.traceFile.Close(); err == nil {
+				err = cerr
+			}
+		}
+		app.traceFile = f
+	})
+	return err
+}
+
+func (app *App) onFrame(frame uint, vp *model.ViewPort) {
+	if app.frameDump != nil {
+		app.frameDump.OnFrame(frame, vp)
+	}
+	if err := app.snapshots.OnFrame(app.GB, app.CLK, frame); err != nil {
+		fmt.Printf("rewind: %v\n", err)
+	}
+}
+
+func (app *App) onInput(ev model.InputEvent) {
+	app.snapshots.RecordInput(ev)
+	if app.movie != nil {
+		app.movie.Record(ev)
+	}
+	if app.moviePlaying.Load() && ev.Cycle >= app.movieEnd {
+		app.moviePlaying.Store(false)
+	}
+}
+
 func (app *App) GetConfig() *Config {
 	return app.config
 }
@@ -133,6 +338,10 @@ type Frame struct {
 }
 
 func (app *App) SetKeyState(in map[string]bool) {
+	// Live input would make the movie play out differently from the recording
+	if app.moviePlaying.Load() {
+		return
+	}
 	jp := app.ButtonMapping.JoypadState(in)
 	app.GB.Joypad.SetState(app.CLK, app.GB, jp)
 }
@@ -146,10 +355,6 @@ func (app *App) MachineStateRequest(req MachineStateRequest) {
 		app.CLK.SetSpeedPercent(req.Numbers["TargetSpeed"], app.GBAudio)
 		fmt.Printf("Updated speed to %f\n", req.Numbers["TargetSpeed"])
 	}
-	if req.ClickedNumber == "pc-breakpoint" {
-		app.GB.Debug.Debugger.BreakPC = int64(req.Numbers["pc-breakpoint"])
-		fmt.Printf("Updated BreakPC to %f\n", req.Numbers["pc-breakpoint"])
-	}
 
 	app.reqChan <- req
 }
@@ -174,7 +379,7 @@ func (app *App) startWebSocketServer() {
 			return
 		}
 
-		nGoroutines := 2
+		nGoroutines := 3
 		exit := make(chan struct{}, nGoroutines)
 
 		prevDisRange := Range{0, 0}
@@ -188,10 +393,23 @@ func (app *App) startWebSocketServer() {
 			DataIDOAM:          {Interval: time.Millisecond * 100},
 			DataIDCPUState:     {Interval: time.Millisecond * 500},
 			DataIDExecutionLog: {Interval: time.Millisecond * 500, PausedOnly: true},
+			DataIDBreakpoints:  {Interval: time.Millisecond * 500},
 		}
 		var req MachineStateRequest
 		mu := &sync.Mutex{}
 
+		// Control messages from the frontend
+		go func() {
+			for {
+				_, msg, err := conn.ReadMessage()
+				if err != nil {
+					exit <- struct{}{}
+					return
+				}
+				app.control(string(msg))
+			}
+		}()
+
 		// Hammer the websocket with frames from the PPU
 		go func() {
 			for {
@@ -245,7 +463,7 @@ func (app *App) startWebSocketServer() {
 						fmt.Fprintf(buf, "IF=%s IE=%s IME=%v\n", app.GB.Mem[model.AddrIF].Hex(), app.GB.Mem[model.AddrIE].Hex(), app.GB.Interrupts.IME)
 						fmt.Fprintf(buf, "Pended: %s\n", app.GB.Interrupts.PendingInterrupt)
 						di, cycle := app.GB.CPU.CurrInstruction()
-						fmt.Fprintf(buf, "\n%s\n   cycle=%d", di.Asm(), cycle)
+						fmt.Fprintf(buf, "\n%s\n   cycle=%d", di.Asm(app.GB), cycle)
 						fmt.Fprintf(buf, "                                     ")
 					}
 					if buf := buffers[DataIDPPURegisters]; buf != nil {
@@ -273,17 +491,22 @@ func (app *App) startWebSocketServer() {
 						)
 					}
 					if buf := buffers[DataIDExecutionLog]; buf != nil {
+						app.GB.PrintCallStack(buf)
+						fmt.Fprintf(buf, "\n")
 						app.GB.PrintRewindBuffer(buf, true)
 					}
 					if buf := buffers[DataIDCartridge]; buf != nil {
 						app.GB.PrintCartridgeInfo(buf)
 					}
+					if buf := buffers[DataIDBreakpoints]; buf != nil {
+						app.GB.Debug.Debugger.PrintBreakpoints(buf)
+					}
 					if buf := buffers[DataIDDisassembly]; buf != nil {
 						rng := req.Ranges[DataIDDisassembly.String()]
 						rng = rng.Constrain(0x0000, 0xffff)
 						if rng != prevDisRange {
 							dis := app.GB.Debug.Disassembler.Disassembly(model.Addr(rng.Begin), model.Addr(rng.End))
-							dis.Print(buf)
+							dis.Print(buf, app.GB)
 						}
 						prevDisRange = rng
 					}
@@ -441,64 +664,338 @@ func (app *App) RequestExecutionLog() {
 	}
 }
 
-func (app *App) Save() {
+// Saves the machine state to the given slot for the current ROM
+func (app *App) Save(slot int) error {
+	path := model.SaveStatePath(app.config.ROMLocation, slot)
+	var err error
 	app.CLK.Sync(func() {
 		app.GBMu.Lock()
 		defer app.GBMu.Unlock()
+		err = app.GB.SaveState(path, app.CLK)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Saved state to %s\n", path)
 
-		buf := bytes.Buffer{}
-		gz := gzip.NewWriter(&buf)
-		enc := gob.NewEncoder(gz)
-		err := enc.Encode(app.GB)
-		errClose := gz.Close()
-		if err == nil {
-			err = errClose
-		}
-		if err == nil {
-			err = os.WriteFile("gb.sav", buf.Bytes(), 0o666)
+	select {
+	case <-app.needStateUpdate:
+	default:
+	}
+	return nil
+}
+
+// Loads the machine state from the given slot for the current ROM
+func (app *App) Load(slot int) error {
+	path := model.SaveStatePath(app.config.ROMLocation, slot)
+	var err error
+	app.CLK.Sync(func() {
+		app.GBMu.Lock()
+		defer app.GBMu.Unlock()
+		err = app.GB.LoadState(path, app.CLK)
+		if err != nil {
+			return
 		}
-		if err == nil {
-			fmt.Printf("SAV: %d kB\n", buf.Len()/1024)
-		} else {
-			fmt.Printf("save state create failed: %v", err)
+		if app.movieBatteryPath != "" {
+			app.GB.Cartridge.BatteryPath = app.movieBatteryPath
+			app.movieBatteryPath = ""
 		}
+
+		// The history before loading is from a different timeline
+		app.snapshots.Reset()
+		err = app.snapshots.Take(app.GB, app.CLK)
 	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Loaded state from %s\n", path)
 
 	select {
 	case <-app.needStateUpdate:
 	default:
 	}
+	return nil
 }
 
-func (app *App) Load() {
-	app.CLK.Stop()
-	app.GBMu.Lock()
-	defer app.GBMu.Unlock()
+// Handles a control message received over the websocket:
+//
+//	rewind-frame | rewind-start | rewind-stop
+//	break-add <pc|ir|ppu|read|write|change> <location> [ignore <n>] [if <condition>]
+//	break-remove <id> | break-enable <id> | break-disable <id>
+func (app *App) control(msg string) {
+	var err error
+	cmd, args, _ := strings.Cut(msg, " ")
+	switch cmd {
+	case "rewind-frame":
+		err = app.RewindFrame()
+	case "rewind-start":
+		app.StartRewind()
+	case "rewind-stop":
+		app.StopRewind()
+	case "break-add":
+		err = app.controlBreakAdd(args)
+	case "break-remove", "break-enable", "break-disable":
+		var id int
+		if id, err = strconv.Atoi(strings.TrimSpace(args)); err != nil {
+			break
+		}
+		switch cmd {
+		case "break-remove":
+			err = app.RemoveBreakpoint(id)
+		case "break-enable":
+			err = app.EnableBreakpoint(id, true)
+		case "break-disable":
+			err = app.EnableBreakpoint(id, false)
+		}
+	default:
+		err = fmt.Errorf("unknown control message '%s'", msg)
+	}
+	if err != nil {
+		fmt.Printf("%v\n", err)
+	}
+}
+
+func (app *App) controlBreakAdd(args string) error {
+	args, condition, _ := strings.Cut(args, " if ")
+	fields := strings.Fields(args)
+	if len(fields) != 2 && len(fields) != 4 {
+		return fmt.Errorf("usage: break-add <pc|ir|ppu|read|write|change> <location> [ignore <n>] [if <condition>]")
+	}
+	var ignore uint64
+	if len(fields) == 4 {
+		if fields[2] != "ignore" {
+			return fmt.Errorf("expected 'ignore', got '%s'", fields[2])
+		}
+		var err error
+		if ignore, err = strconv.ParseUint(fields[3], 10, 32); err != nil {
+			return fmt.Errorf("invalid ignore count '%s'", fields[3])
+		}
+	}
+	_, err := app.AddBreakpoint(fields[0], fields[1], strings.TrimSpace(condition), uint(ignore))
+	return err
+}
+
+// Pauses and steps back to the previous snapshot
+func (app *App) RewindFrame() error {
+	app.Pause()
+	_, err := app.rewindStep()
+	return err
+}
+
+func (app *App) rewindStep() (bool, error) {
+	return app.reverse(app.snapshots.StepBack)
+}
+
+// Pauses and steps back one instruction, the reverse of Step
+func (app *App) StepBack() error {
+	app.Pause()
+	ok, err := app.reverse(app.snapshots.StepBackInstruction)
+	if err == nil && !ok {
+		fmt.Printf("Reached the start of the rewind history\n")
+	}
+	return err
+}
+
+// Pauses and runs backwards to the previous breakpoint hit
+func (app *App) ReverseContinue() error {
+	app.Pause()
+	ok, err := app.reverse(app.snapshots.ReverseContinue)
+	if err == nil && !ok {
+		fmt.Printf("No earlier breakpoint hit, stopped at the start of the rewind history\n")
+	}
+	return err
+}
+
+func (app *App) reverse(f func(gb *model.Gameboy, clk *model.ClockRT) (bool, error)) (bool, error) {
+	var ok bool
+	var err error
+	app.CLK.Sync(func() {
+		app.GBMu.Lock()
+		defer app.GBMu.Unlock()
+		ok, err = f(app.GB, app.CLK)
+		app.GB.PPU.PublishFrame(app.FrameSync)
+	})
+	select {
+	case <-app.needStateUpdate:
+	default:
+	}
+	return ok, err
+}
+
+// Pauses and keeps stepping back at the rate the snapshots were taken until StopRewind is called
+func (app *App) StartRewind() {
+	app.rewindMu.Lock()
+	defer app.rewindMu.Unlock()
+	if app.rewindStop != nil {
+		return
+	}
+	app.rewindResume = app.CLK.Pause()
+	app.GBRunFlag.Store(false)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	app.rewindStop = stop
+	app.rewindDone = done
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(model.FrameDuration * time.Duration(app.snapshots.Interval))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			if ok, err := app.rewindStep(); err != nil {
+				fmt.Printf("rewind: %v\n", err)
+				return
+			} else if !ok {
+				return
+			}
+		}
+	}()
+}
+
+// Stops rewinding and resumes emulation if it was running when StartRewind was called
+func (app *App) StopRewind() {
+	app.rewindMu.Lock()
+	defer app.rewindMu.Unlock()
+	if app.rewindStop == nil {
+		return
+	}
+	close(app.rewindStop)
+	<-app.rewindDone
+	app.rewindStop = nil
+	app.rewindDone = nil
+	if app.rewindResume {
+		app.Start()
+	}
+}
+
+// Starts recording input to a movie that begins at the current state
+func (app *App) StartMovieRecording(path string) error {
+	var err error
+	app.CLK.Sync(func() {
+		var movie *model.Movie
+		movie, err = app.GB.NewMovieFromState(app.CLK, time.Now())
+		if err != nil {
+			return
+		}
+		app.movie = movie
+		app.moviePath = path
+	})
+	return err
+}
 
-	var newGB model.Gameboy
-	data, err := os.ReadFile("gb.sav")
-	var gz io.ReadCloser
-	var openErr error
-	if err == nil {
-		fmt.Printf("LOAD: %d kB\n", len(data)/1024)
+// Stops recording and writes the movie
+func (app *App) StopMovieRecording() error {
+	var movie *model.Movie
+	var path string
+	app.CLK.Sync(func() {
+		movie, path = app.movie, app.moviePath
+		app.movie = nil
+	})
+	if movie == nil {
+		return fmt.Errorf("not recording a movie")
+	}
+	if err := movie.Save(path); err != nil {
+		return err
+	}
+	fmt.Printf("Saved movie with %d inputs to %s\n", len(movie.Inputs), path)
+	return nil
+}
 
-		buf := bytes.NewBuffer(data)
-		gz, openErr = gzip.NewReader(buf)
-		err = openErr
+// Restores the initial state of a movie and plays back its input
+func (app *App) PlayMovie(path string) error {
+	movie, err := model.LoadMovie(path)
+	if err != nil {
+		return err
 	}
-	if err == nil {
-		dec := gob.NewDecoder(gz)
-		err = dec.Decode(&newGB)
+	app.CLK.Sync(func() {
+		app.GBMu.Lock()
+		defer app.GBMu.Unlock()
+
+		// Save the game's own RAM before the movie replaces it
+		if app.GB.Cartridge.BatteryPath != "" {
+			if err := app.GB.FlushBattery(); err != nil {
+				fmt.Printf("battery save failed: %v\n", err)
+			}
+			app.movieBatteryPath = app.GB.Cartridge.BatteryPath
+		}
+		err = movie.Play(app.GB, app.CLK)
+		if err != nil {
+			return
+		}
+		app.movieEnd = movie.End()
+		app.moviePlaying.Store(len(movie.Inputs) > 0)
+		app.snapshots.Reset()
+		err = app.snapshots.Take(app.GB, app.CLK)
+	})
+	if err != nil {
+		return err
 	}
-	if err == nil {
-		err = gz.Close()
+	fmt.Printf("Playing movie %s\n", path)
+
+	select {
+	case <-app.needStateUpdate:
+	default:
 	}
-	if err == nil {
-		app.startGB(&newGB)
+	return nil
+}
+
+// Adds a breakpoint and returns its ID. See model.ParseBreakpoint for kind and location, and model/condition.go for the condition.
+func (app *App) AddBreakpoint(kind, location, condition string, ignore uint) (int, error) {
+	var bp model.Breakpoint
+	var id int
+	var err error
+	app.CLK.Sync(func() {
+		if bp, err = model.ParseBreakpoint(kind, location, &app.GB.Debug.Symbols); err != nil {
+			return
+		}
+		bp.Condition = condition
+		bp.Ignore = ignore
+		id, err = app.GB.Debug.Debugger.AddBreakpoint(bp)
+	})
+	if err != nil {
+		return 0, err
+	}
+	fmt.Printf("Added breakpoint %d (%s)\n", id, bp.Where())
+	select {
+	case <-app.needStateUpdate:
+	default:
 	}
+	return id, nil
+}
 
+func (app *App) RemoveBreakpoint(id int) error {
+	var err error
+	app.CLK.Sync(func() {
+		err = app.GB.Debug.Debugger.RemoveBreakpoint(id)
+	})
 	select {
 	case <-app.needStateUpdate:
 	default:
 	}
+	return err
+}
+
+func (app *App) EnableBreakpoint(id int, enabled bool) error {
+	var err error
+	app.CLK.Sync(func() {
+		err = app.GB.Debug.Debugger.EnableBreakpoint(id, enabled)
+	})
+	select {
+	case <-app.needStateUpdate:
+	default:
+	}
+	return err
+}
+
+// The breakpoints as text, one per line
+func (app *App) ListBreakpoints() string {
+	var buf bytes.Buffer
+	app.CLK.Sync(func() {
+		app.GB.Debug.Debugger.PrintBreakpoints(&buf)
+	})
+	return buf.String()
 }
@@ -25,11 +25,12 @@ const (
 	DataIDClock
 	DataIDExecutionLog
 	DataIDCartridge
+	DataIDBreakpoints
 )
 
 var ErrInvalidDataID = errors.New("not a valid DataID")
 
-const _DataIDName = "NoneViewportCPURegistersPPURegistersAPURegistersDisassemblyHRAMWRAMOAMCPUStateClockExecutionLogCartridge"
+const _DataIDName = "NoneViewportCPURegistersPPURegistersAPURegistersDisassemblyHRAMWRAMOAMCPUStateClockExecutionLogCartridgeBreakpoints"
 
 // DataIDValues returns a list of the values for DataID
 func DataIDValues() []DataID {
@@ -47,6 +48,7 @@ func DataIDValues() []DataID {
 		DataIDClock,
 		DataIDExecutionLog,
 		DataIDCartridge,
+		DataIDBreakpoints,
 	}
 }
 
@@ -64,6 +66,7 @@ var _DataIDMap = map[DataID]string{
 	DataIDClock:        _DataIDName[78:83],
 	DataIDExecutionLog: _DataIDName[83:95],
 	DataIDCartridge:    _DataIDName[95:104],
+	DataIDBreakpoints:  _DataIDName[104:115],
 }
 
 // String implements the Stringer interface.
@@ -82,19 +85,20 @@ func (x DataID) IsValid() bool {
 }
 
 var _DataIDValue = map[string]DataID{
-	_DataIDName[0:4]:    DataIDNone,
-	_DataIDName[4:12]:   DataIDViewport,
-	_DataIDName[12:24]:  DataIDCPURegisters,
-	_DataIDName[24:36]:  DataIDPPURegisters,
-	_DataIDName[36:48]:  DataIDAPURegisters,
-	_DataIDName[48:59]:  DataIDDisassembly,
-	_DataIDName[59:63]:  DataIDHRAM,
-	_DataIDName[63:67]:  DataIDWRAM,
-	_DataIDName[67:70]:  DataIDOAM,
-	_DataIDName[70:78]:  DataIDCPUState,
-	_DataIDName[78:83]:  DataIDClock,
-	_DataIDName[83:95]:  DataIDExecutionLog,
-	_DataIDName[95:104]: DataIDCartridge,
+	_DataIDName[0:4]:     DataIDNone,
+	_DataIDName[4:12]:    DataIDViewport,
+	_DataIDName[12:24]:   DataIDCPURegisters,
+	_DataIDName[24:36]:   DataIDPPURegisters,
+	_DataIDName[36:48]:   DataIDAPURegisters,
+	_DataIDName[48:59]:   DataIDDisassembly,
+	_DataIDName[59:63]:   DataIDHRAM,
+	_DataIDName[63:67]:   DataIDWRAM,
+	_DataIDName[67:70]:   DataIDOAM,
+	_DataIDName[70:78]:   DataIDCPUState,
+	_DataIDName[78:83]:   DataIDClock,
+	_DataIDName[83:95]:   DataIDExecutionLog,
+	_DataIDName[95:104]:  DataIDCartridge,
+	_DataIDName[104:115]: DataIDBreakpoints,
 }
 
 // ParseDataID attempts to convert a string to a DataID.
@@ -125,7 +129,7 @@ func (x *DataID) UnmarshalText(text []byte) error {
 // (allocating a larger slice if necessary) and returns the updated slice.
 //
 // Implementations must not retain b, nor mutate any bytes within b[:len(b)].
-func (x *DataID) AppendText(b []byte) ([]byte, error) {
+func (x DataID) AppendText(b []byte) ([]byte, error) {
 	return append(b, x.String()...), nil
 }
 
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"io"
 
 	"github.com/ebitengine/oto/v3"
@@ -22,7 +23,13 @@ func NewAudio() *AudioInterface {
 	opts.Format = oto.FormatSignedInt16LE
 	otoCtx, readyChan, err := oto.NewContext(opts)
 	if err != nil {
-		panic("oto.NewContext failed with " + err.Error())
+		// Keep running without sound, e.g. on a machine without an audio device
+		fmt.Printf("audio disabled: oto.NewContext failed with %v\n", err)
+		go func() {
+			for range aif.In {
+			}
+		}()
+		return aif
 	}
 	<-readyChan
 	aif.player = otoCtx.NewPlayer(aif)
@@ -0,0 +1,62 @@
+// Disassembles a ROM into RGBDS source that assembles back to the same ROM.
+//
+//	disassembler -rom game.gb -o game.asm
+//	rgbasm -o game.o game.asm && rgblink -o game.gb game.o
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jonathangjertsen/toyboy/model"
+)
+
+func main() {
+	var romPath, outPath string
+	flag.StringVar(&romPath, "rom", "", "path to the ROM to disassemble")
+	flag.StringVar(&outPath, "o", "", "path to write the .asm file to (default stdout)")
+	flag.Parse()
+
+	if romPath == "" {
+		fmt.Fprintf(os.Stderr, "missing -rom\n")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(romPath, outPath); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(romPath, outPath string) error {
+	rom, err := os.ReadFile(romPath)
+	if err != nil {
+		return err
+	}
+	if len(rom) == 0 || len(rom)%model.ROMBankSize != 0 {
+		return fmt.Errorf("ROM size %d is not a multiple of %d", len(rom), model.ROMBankSize)
+	}
+
+	out := os.Stdout
+	if outPath != "" {
+		if out, err = os.Create(outPath); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "; Disassembly of %s\n\n", filepath.Base(romPath))
+	if err := model.WriteRGBDS(w, model.DisassembleROM(model.Data8Slice(rom))); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if outPath != "" {
+		return out.Close()
+	}
+	return nil
+}
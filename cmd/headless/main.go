@@ -0,0 +1,337 @@
+// Runs a ROM without a display or audio device, e.g. in CI or from scripts.
+//
+//	headless -rom game.gb -frames 600
+//	headless -rom game.gb -gdb localhost:2345
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image/color"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonathangjertsen/toyboy/model"
+)
+
+// Number of M-cycles to run between each time the throttle and the limits are checked
+const chunkSize = 1024
+
+const mCyclesPerSecond = 4194304 / 4
+
+type Options struct {
+	ROM          string
+	Boot         string
+	Frames       uint
+	Cycles       uint
+	SpeedPercent float64
+	Screenshot   string
+	DumpDir      string
+	DumpEvery    uint
+	DumpFrames   string
+	Palette      string
+	LinkCable    string
+	SerialUntil  string
+	Movie        string
+	GDB          string
+	Symbols      string
+	Trace        string
+	StubLY       bool
+}
+
+func main() {
+	var opts Options
+	flag.StringVar(&opts.ROM, "rom", "", "path to the ROM to run")
+	flag.StringVar(&opts.Boot, "boot", "dmg", "boot ROM: 'dmg' runs the DMG boot ROM, 'skip' starts at the cartridge entry point")
+	flag.UintVar(&opts.Frames, "frames", 0, "stop after this many frames (0 = no limit)")
+	flag.UintVar(&opts.Cycles, "cycles", 0, "stop after this many M-cycles (0 = no limit)")
+	flag.Float64Var(&opts.SpeedPercent, "speed", 0, "emulation speed in percent of real hardware (0 = unthrottled)")
+	flag.StringVar(&opts.Screenshot, "screenshot", "", "save the final frame to this PNG file")
+	flag.StringVar(&opts.DumpDir, "dump-dir", "", "directory to write frame dumps to")
+	flag.UintVar(&opts.DumpEvery, "dump-every", 0, "dump every Nth frame to -dump-dir (0 = none)")
+	flag.StringVar(&opts.DumpFrames, "dump-frames", "", "comma-separated frame numbers to dump to -dump-dir")
+	flag.StringVar(&opts.Palette, "palette", "", "comma-separated hex colors for the 4 shades, lightest first (default grayscale)")
+	flag.StringVar(&opts.LinkCable, "link", "none", "link cable: 'none', 'loopback', 'listen:<addr>' or 'connect:<addr>'")
+	flag.StringVar(&opts.SerialUntil, "serial-until", "", "comma-separated strings, stop when one of them is printed over serial (e.g. 'Passed,Failed')")
+	flag.StringVar(&opts.Movie, "movie", "", "play back the input in this movie file")
+	flag.StringVar(&opts.GDB, "gdb", "", "wait for a GDB client on this address (e.g. 'localhost:2345') and run until it kills the target")
+	flag.StringVar(&opts.Symbols, "sym", "", "RGBDS .sym file with labels for the debugger (default: next to the ROM, if it exists)")
+	flag.StringVar(&opts.Trace, "trace", "", "write a Gameboy Doctor trace line per executed instruction to this file ('-' for stdout)")
+	flag.BoolVar(&opts.StubLY, "trace-ly90", false, "make LY read as $90 while tracing, like the Gameboy Doctor reference logs")
+	flag.Parse()
+
+	if opts.ROM == "" {
+		fmt.Fprintf(os.Stderr, "missing -rom\n")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if opts.Frames == 0 && opts.Cycles == 0 && opts.SerialUntil == "" && opts.GDB == "" {
+		fmt.Fprintf(os.Stderr, "need -frames, -cycles, -serial-until or -gdb, otherwise the emulator would run forever\n")
+		os.Exit(2)
+	}
+
+	gb, clk, err := run(&opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	printState(gb, clk)
+}
+
+func run(opts *Options) (gb *model.Gameboy, clk *model.ClockRT, err error) {
+	config := model.DefaultConfig
+	config.Debug.RewindSize = 64
+	switch opts.Boot {
+	case "dmg":
+		config.BootROM.Variant = "DMGBoot"
+	case "skip":
+		config.BootROM.Variant = "None"
+		config.BootROM.Skip = true
+	default:
+		return nil, nil, fmt.Errorf("unknown boot ROM '%s'", opts.Boot)
+	}
+	if opts.StubLY && opts.Trace == "" {
+		return nil, nil, fmt.Errorf("-trace-ly90 requires -trace")
+	}
+	config.Debug.StubLY = opts.StubLY
+
+	clk = model.NewClock()
+	gb = &model.Gameboy{}
+	gb.AllocMem()
+	gb.Init(&config, clk)
+	if err := model.LoadROM(opts.ROM, gb); err != nil {
+		return nil, nil, fmt.Errorf("loading ROM: %w", err)
+	}
+	if config.BootROM.Skip {
+		gb.SkipBootROM()
+	}
+	if err := loadSymbols(gb, opts); err != nil {
+		return nil, nil, err
+	}
+	if opts.Movie != "" {
+		movie, err := model.LoadMovie(opts.Movie)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := movie.Play(gb, clk); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	palette, err := parsePalette(opts.Palette)
+	if err != nil {
+		return nil, nil, err
+	}
+	dump, err := frameDump(opts, palette)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dump != nil {
+		clk.AttachFrameListener(dump.OnFrame)
+	}
+
+	peer, err := model.NewSerialPeer(opts.LinkCable)
+	if err != nil {
+		return nil, nil, err
+	}
+	if closer, ok := peer.(io.Closer); ok {
+		defer closer.Close()
+	}
+	clk.SetSerialPeer(peer)
+
+	if opts.Trace != "" {
+		closeTrace, err := startTrace(clk, opts.Trace)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer func() {
+			if cerr := closeTrace(); err == nil {
+				err = cerr
+			}
+		}()
+	}
+
+	var killed <-chan struct{}
+	if opts.GDB != "" {
+		gdb, err := model.ListenGDB(opts.GDB, gb, clk)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gdb.Close()
+		killed = gdb.Killed()
+
+		// Stop before the first M-cycle until the client continues
+		clk.PauseAfterCycle.Add(1)
+		fmt.Fprintf(os.Stderr, "Waiting for GDB on %s\n", gdb.Addr())
+	}
+
+	// Only capture when asked to, since the output grows without bound
+	var serialUntil []string
+	if opts.SerialUntil != "" {
+		serialUntil = strings.Split(opts.SerialUntil, ",")
+		gb.Serial.Capture = true
+	}
+
+	audio, devnull := model.AudioStub()
+	defer close(devnull)
+	fs := model.FrameSync{Ch: make(chan func(*model.ViewPort), 1)}
+
+	defer func() {
+		if e := recover(); e != nil {
+			gb.CPU.Dump(gb)
+			err = fmt.Errorf("emulator panicked: %v", e)
+		}
+	}()
+
+	start := time.Now()
+	serialLen := 0
+loop:
+	for {
+		select {
+		case <-killed:
+			break loop
+		default:
+		}
+		if len(gb.Serial.Output) != serialLen {
+			serialLen = len(gb.Serial.Output)
+			if slices.ContainsFunc(serialUntil, func(s string) bool { return strings.Contains(gb.SerialOutput(), s) }) {
+				break
+			}
+		}
+		if opts.Frames > 0 && gb.PPU.FrameCount >= opts.Frames {
+			break
+		}
+		n := chunkSize
+		if opts.Cycles > 0 {
+			if clk.Cycle/4 >= opts.Cycles {
+				break
+			}
+			n = int(min(uint(n), opts.Cycles-clk.Cycle/4))
+		}
+		clk.MCycle(n, gb, audio, &fs)
+
+		if opts.SpeedPercent > 0 {
+			emulated := time.Duration(float64(clk.Cycle/4) / (mCyclesPerSecond * opts.SpeedPercent / 100) * float64(time.Second))
+			if ahead := emulated - time.Since(start); ahead > 0 {
+				time.Sleep(ahead)
+			}
+		}
+	}
+
+	if dump != nil && dump.Err != nil {
+		return gb, clk, fmt.Errorf("dumping frames: %w", dump.Err)
+	}
+	if opts.Screenshot != "" {
+		if err := gb.PPU.FBViewport.SavePNG(opts.Screenshot, palette); err != nil {
+			return gb, clk, err
+		}
+	}
+	return gb, clk, gb.SaveBattery()
+}
+
+// Starts the trace, returning a function that flushes and closes it
+func startTrace(clk *model.ClockRT, path string) (func() error, error) {
+	var w io.WriteCloser = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("creating trace: %w", err)
+		}
+		w = f
+	}
+	clk.SetTrace(w)
+	return func() error {
+		err := clk.SetTrace(nil)
+		if w != os.Stdout {
+			if cerr := w.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
+
+func frameDump(opts *Options, palette [4]color.RGBA) (*model.FrameDump, error) {
+	if opts.DumpEvery == 0 && opts.DumpFrames == "" {
+		return nil, nil
+	}
+	if opts.DumpDir == "" {
+		return nil, fmt.Errorf("-dump-every and -dump-frames need -dump-dir")
+	}
+	if err := os.MkdirAll(opts.DumpDir, 0o777); err != nil {
+		return nil, fmt.Errorf("creating frame dump directory: %w", err)
+	}
+	dump := &model.FrameDump{
+		Dir:     opts.DumpDir,
+		Palette: palette,
+		Every:   opts.DumpEvery,
+	}
+	if opts.DumpFrames != "" {
+		for _, field := range strings.Split(opts.DumpFrames, ",") {
+			frame, err := strconv.ParseUint(strings.TrimSpace(field), 10, 0)
+			if err != nil {
+				return nil, fmt.Errorf("invalid frame number '%s'", field)
+			}
+			dump.Frames = append(dump.Frames, uint(frame))
+		}
+	}
+	return dump, nil
+}
+
+// Parses e.g. "e0f8d0,88c070,346856,081820"
+func parsePalette(s string) ([4]color.RGBA, error) {
+	if s == "" {
+		return model.RGBA, nil
+	}
+	var palette [4]color.RGBA
+	fields := strings.Split(s, ",")
+	if len(fields) != len(palette) {
+		return palette, fmt.Errorf("palette needs %d colors, got %d", len(palette), len(fields))
+	}
+	for i, field := range fields {
+		rgb, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(field), "#"), 16, 24)
+		if err != nil {
+			return palette, fmt.Errorf("invalid palette color '%s'", field)
+		}
+		palette[i] = color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xff}
+	}
+	return palette, nil
+}
+
+func printState(gb *model.Gameboy, clk *model.ClockRT) {
+	f := os.Stdout
+	fmt.Fprintf(f, "Title: %s\n", gb.CartridgeTitle())
+	fmt.Fprintf(f, "Frames: %d\n", gb.PPU.FrameCount)
+	fmt.Fprintf(f, "M-cycles: %d\n", clk.Cycle/4)
+	fmt.Fprintf(f, "Boot ROM done: %v\n", gb.BootROMLock.BootOff)
+	if res := gb.Debug.Debugger.Mooneye; res != model.MooneyeResultNone {
+		fmt.Fprintf(f, "Mooneye: %s\n", res)
+	}
+	if out := gb.SerialOutput(); out != "" {
+		fmt.Fprintf(f, "Serial output:\n%s\n", out)
+	}
+	model.PrintRegs(f, gb.CPU.Regs)
+	gb.PrintCallStack(f)
+}
+
+func loadSymbols(gb *model.Gameboy, opts *Options) error {
+	path := opts.Symbols
+	if path == "" {
+		path = model.SymbolsPath(opts.ROM)
+	}
+	syms, err := model.LoadSymbols(path)
+	if opts.Symbols == "" && errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("loading symbols: %w", err)
+	}
+	gb.Debug.Symbols = syms
+	return nil
+}
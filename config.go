@@ -13,6 +13,10 @@ var DefaultConfig = Config{
 	Location:    "config.json",
 	ROMLocation: "assets/cartridges/unbricked.gb",
 	Model:       model.DefaultConfig,
+
+	RewindSnapshots: 600,
+	RewindInterval:  1,
+
 	GUI: ConfigGUI{
 		Graphics: ConfigGraphicsGlobal{
 			Overlay:       false,
@@ -116,6 +120,22 @@ type Config struct {
 	Model       model.Config
 	PProfURL    string
 	GUI         ConfigGUI
+
+	// Link cable: "none", "loopback", "listen:<addr>" or "connect:<addr>"
+	LinkCable string
+
+	// Address to serve the GDB remote serial protocol on, e.g. "localhost:2345", or empty to disable
+	GDB string
+
+	// RGBDS .sym file with labels for the debugger, or empty to use the one next to the ROM if it exists
+	SymbolsLocation string
+
+	// Movie file to record from power-on and save when the app closes, or empty to disable
+	RecordMovie string
+
+	// Number of snapshots kept for rewinding, taken every RewindInterval frames
+	RewindSnapshots int
+	RewindInterval  uint
 }
 
 type ConfigGUI struct {
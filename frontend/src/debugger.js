@@ -1,9 +1,21 @@
 const RunBtn = document.getElementById("run-btn");
 const PauseBtn = document.getElementById("pause-btn");
 const StepBtn = document.getElementById("step-btn");
+const StepBackBtn = document.getElementById("step-back-btn");
+const ReverseContinueBtn = document.getElementById("reverse-continue-btn");
+const RewindBtn = document.getElementById("rewind-btn");
 const LoadBtn = document.getElementById("load-btn");
 const SaveBtn = document.getElementById("save-btn");
+const SlotSelect = document.getElementById("slot-select");
+const RecordMovieBtn = document.getElementById("record-movie-btn");
+const PlayMovieBtn = document.getElementById("play-movie-btn");
+const TraceBtn = document.getElementById("trace-btn");
 const ExecLogBtn = document.getElementById("execlog-btn");
+const BreakpointKind = document.getElementById("breakpoint-kind");
+const BreakpointLocation = document.getElementById("breakpoint-location");
+const BreakpointCondition = document.getElementById("breakpoint-condition");
+const BreakpointIgnore = document.getElementById("breakpoint-ignore");
+const BreakpointID = document.getElementById("breakpoint-id");
 
 RunBtn.addEventListener('click', () => {
     runBtn()
@@ -14,12 +26,64 @@ PauseBtn.addEventListener('click', () => {
 StepBtn.addEventListener('click', () => {
     stepBtn()
 })
+StepBackBtn.addEventListener('click', () => {
+    stepBackBtn()
+})
+ReverseContinueBtn.addEventListener('click', () => {
+    reverseContinueBtn()
+})
 SaveBtn.addEventListener('click', () => {
     saveBtn()
 })
 LoadBtn.addEventListener('click', () => {
     loadBtn()
 })
+RecordMovieBtn.addEventListener('click', () => {
+    recordMovieBtn()
+})
+PlayMovieBtn.addEventListener('click', () => {
+    playMovieBtn()
+})
+TraceBtn.addEventListener('click', () => {
+    traceBtn()
+})
+
+document.getElementById("breakpoint-add").addEventListener('click', () => {
+    let cmd = `break-add ${BreakpointKind.value} ${BreakpointLocation.value.replace(/\s/g, "")}`;
+    if (BreakpointIgnore.value.trim() !== "") {
+        cmd += ` ignore ${BreakpointIgnore.value.trim()}`;
+    }
+    if (BreakpointCondition.value.trim() !== "") {
+        cmd += ` if ${BreakpointCondition.value.trim()}`;
+    }
+    sendControl(cmd);
+})
+for (const action of ["enable", "disable", "remove"]) {
+    document.getElementById(`breakpoint-${action}`).addEventListener('click', () => {
+        sendControl(`break-${action} ${BreakpointID.value.trim()}`);
+    })
+}
+
+// Click to step back one snapshot, hold to rewind continuously
+let rewindHoldTimer = null;
+let rewindHolding = false;
+RewindBtn.addEventListener('mousedown', () => {
+    rewindHoldTimer = setTimeout(() => {
+        rewindHoldTimer = null;
+        rewindHolding = true;
+        sendControl("rewind-start");
+    }, 250);
+})
+RewindBtn.addEventListener('mouseup', () => {
+    if (rewindHolding) {
+        rewindHolding = false;
+        sendControl("rewind-stop");
+    } else if (rewindHoldTimer !== null) {
+        clearTimeout(rewindHoldTimer);
+        rewindHoldTimer = null;
+        rewindBtn();
+    }
+})
 
 async function runBtn() {
     await window.go.main.App.Start();
@@ -33,10 +97,98 @@ async function stepBtn() {
     await window.go.main.App.Step();
 }
 
+async function stepBackBtn() {
+    try {
+        await window.go.main.App.StepBack();
+    } catch (err) {
+        alert(err);
+    }
+}
+
+async function reverseContinueBtn() {
+    try {
+        await window.go.main.App.ReverseContinue();
+    } catch (err) {
+        alert(err);
+    }
+}
+
+async function rewindBtn() {
+    try {
+        await window.go.main.App.RewindFrame();
+    } catch (err) {
+        alert(err);
+    }
+}
+
 async function loadBtn() {
-    await window.go.main.App.Load();
+    try {
+        await window.go.main.App.Load(parseInt(SlotSelect.value));
+    } catch (err) {
+        alert(err);
+    }
+}
+
+let recordingMovie = false;
+
+async function recordMovieBtn() {
+    try {
+        if (recordingMovie) {
+            await window.go.main.App.StopMovieRecording();
+            recordingMovie = false;
+            RecordMovieBtn.innerText = "Record Movie";
+            return;
+        }
+        const path = prompt("Record movie to", "movie.tbm");
+        if (!path) {
+            return;
+        }
+        await window.go.main.App.StartMovieRecording(path);
+        recordingMovie = true;
+        RecordMovieBtn.innerText = "Stop Recording";
+    } catch (err) {
+        alert(err);
+    }
+}
+
+async function playMovieBtn() {
+    const path = prompt("Play movie from", "movie.tbm");
+    if (!path) {
+        return;
+    }
+    try {
+        await window.go.main.App.PlayMovie(path);
+    } catch (err) {
+        alert(err);
+    }
+}
+
+let tracing = false;
+
+async function traceBtn() {
+    try {
+        if (tracing) {
+            await window.go.main.App.SetTrace("");
+            tracing = false;
+            TraceBtn.innerText = "Trace";
+            return;
+        }
+        const path = prompt("Write trace to", "trace.log");
+        if (!path) {
+            return;
+        }
+        await window.go.main.App.SetTrace(path);
+        tracing = true;
+        TraceBtn.innerText = "Stop Trace";
+    } catch (err) {
+        alert(err);
+    }
 }
 
 async function saveBtn() {
-    await window.go.main.App.Save();
+    try {
+        await window.go.main.App.Save(parseInt(SlotSelect.value));
+    } catch (err) {
+        alert(err);
+    }
 }
@@ -16,6 +16,7 @@ const ButtonsArray = [
 ];
 const Buttons = Object.fromEntries(Keys.map((k, i) => [k, ButtonsArray[i]]));
 let Frame = null;
+let ControlSocket = null;
 const CPURegistersText = document.getElementById("cpu-registers-text");
 const PPURegistersText = document.getElementById("ppu-registers-text");
 const APURegistersText = document.getElementById("apu-registers-text");
@@ -26,6 +27,7 @@ const ClockText = document.getElementById("clock-text");
 const DisassemblyText = document.getElementById("disassembly-text");
 const ExecutionLogText = document.getElementById("executionlog-text");
 const CartridgeText = document.getElementById("cartridge-text");
+const BreakpointsText = document.getElementById("breakpoints-text");
 
 async function run() {
     config = await window.go.main.App.GetConfig();
@@ -33,6 +35,7 @@ async function run() {
 
     const ws = new WebSocket('ws://localhost:8081/data');
     ws.binaryType = 'arraybuffer';
+    ControlSocket = ws;
 
     let dataID = "";
     const decoder = new TextDecoder();
@@ -100,6 +103,10 @@ async function run() {
                 ClockText.innerText = decoder.decode(data);
                 break;
             }
+            case "Breakpoints": {
+                BreakpointsText.innerText = decoder.decode(data);
+                break;
+            }
         }
         dataID = "";
     };
@@ -132,11 +139,27 @@ async function setKeyState(k, state) {
     await window.go.main.App.SetKeyState(KeyState);
 }
 
+function sendControl(msg) {
+    if (ControlSocket !== null && ControlSocket.readyState === WebSocket.OPEN) {
+        ControlSocket.send(msg);
+    }
+}
+
 document.addEventListener('keydown', (e) => {
+    if (e.key === "Backspace") {
+        if (!e.repeat) {
+            sendControl("rewind-start");
+        }
+        return;
+    }
     setKeyState(e.key.toLowerCase(), true);
 });
 
 document.addEventListener('keyup', (e) => {
+    if (e.key === "Backspace") {
+        sendControl("rewind-stop");
+        return;
+    }
     setKeyState(e.key.toLowerCase(), false);
 });
 
@@ -149,6 +172,13 @@ for (const [k, button] of Object.entries(Buttons)) {
     })
 }
 
+window.runtime.EventsOn("rumble", (on) => {
+    document.getElementById("lcd").classList.toggle("rumble", on);
+    if (on && navigator.vibrate) {
+        navigator.vibrate(50);
+    }
+});
+
 let MachineReq = {
     OpenBoxes: {},
     Numbers: {},
@@ -2,20 +2,52 @@
 // This file is automatically generated. DO NOT EDIT
 import {main} from '../models';
 
+export function AddBreakpoint(arg1:string,arg2:string,arg3:string,arg4:number):Promise<number>;
+
+export function EnableBreakpoint(arg1:number,arg2:boolean):Promise<void>;
+
 export function GetConfig():Promise<main.Config>;
 
-export function Load():Promise<void>;
+export function ListBreakpoints():Promise<string>;
+
+export function Load(arg1:number):Promise<void>;
 
 export function MachineStateRequest(arg1:main.MachineStateRequest):Promise<void>;
 
 export function Pause():Promise<void>;
 
+export function PlayMovie(arg1:string):Promise<void>;
+
+export function RemoveBreakpoint(arg1:number):Promise<void>;
+
 export function RequestExecutionLog():Promise<void>;
 
-export function Save():Promise<void>;
+export function ReverseContinue():Promise<void>;
+
+export function RewindFrame():Promise<void>;
+
+export function Save(arg1:number):Promise<void>;
+
+export function Screenshot(arg1:string):Promise<void>;
 
 export function SetKeyState(arg1:Record<string, boolean>):Promise<void>;
 
+export function SetTrace(arg1:string):Promise<void>;
+
 export function Start():Promise<void>;
 
+export function StartFrameDump(arg1:string,arg2:number,arg3:Array<number>):Promise<void>;
+
+export function StartMovieRecording(arg1:string):Promise<void>;
+
+export function StartRewind():Promise<void>;
+
 export function Step():Promise<void>;
+
+export function StepBack():Promise<void>;
+
+export function StopFrameDump():Promise<void>;
+
+export function StopMovieRecording():Promise<void>;
+
+export function StopRewind():Promise<void>;
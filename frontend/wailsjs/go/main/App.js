@@ -2,12 +2,24 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AddBreakpoint(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['AddBreakpoint'](arg1, arg2, arg3, arg4);
+}
+
+export function EnableBreakpoint(arg1, arg2) {
+  return window['go']['main']['App']['EnableBreakpoint'](arg1, arg2);
+}
+
 export function GetConfig() {
   return window['go']['main']['App']['GetConfig']();
 }
 
-export function Load() {
-  return window['go']['main']['App']['Load']();
+export function ListBreakpoints() {
+  return window['go']['main']['App']['ListBreakpoints']();
+}
+
+export function Load(arg1) {
+  return window['go']['main']['App']['Load'](arg1);
 }
 
 export function MachineStateRequest(arg1) {
@@ -18,22 +30,74 @@ export function Pause() {
   return window['go']['main']['App']['Pause']();
 }
 
+export function PlayMovie(arg1) {
+  return window['go']['main']['App']['PlayMovie'](arg1);
+}
+
+export function RemoveBreakpoint(arg1) {
+  return window['go']['main']['App']['RemoveBreakpoint'](arg1);
+}
+
 export function RequestExecutionLog() {
   return window['go']['main']['App']['RequestExecutionLog']();
 }
 
-export function Save() {
-  return window['go']['main']['App']['Save']();
+export function ReverseContinue() {
+  return window['go']['main']['App']['ReverseContinue']();
+}
+
+export function RewindFrame() {
+  return window['go']['main']['App']['RewindFrame']();
+}
+
+export function Save(arg1) {
+  return window['go']['main']['App']['Save'](arg1);
+}
+
+export function Screenshot(arg1) {
+  return window['go']['main']['App']['Screenshot'](arg1);
 }
 
 export function SetKeyState(arg1) {
   return window['go']['main']['App']['SetKeyState'](arg1);
 }
 
+export function SetTrace(arg1) {
+  return window['go']['main']['App']['SetTrace'](arg1);
+}
+
 export function Start() {
   return window['go']['main']['App']['Start']();
 }
 
+export function StartFrameDump(arg1, arg2, arg3) {
+  return window['go']['main']['App']['StartFrameDump'](arg1, arg2, arg3);
+}
+
+export function StartMovieRecording(arg1) {
+  return window['go']['main']['App']['StartMovieRecording'](arg1);
+}
+
+export function StartRewind() {
+  return window['go']['main']['App']['StartRewind']();
+}
+
 export function Step() {
   return window['go']['main']['App']['Step']();
 }
+
+export function StepBack() {
+  return window['go']['main']['App']['StepBack']();
+}
+
+export function StopFrameDump() {
+  return window['go']['main']['App']['StopFrameDump']();
+}
+
+export function StopMovieRecording() {
+  return window['go']['main']['App']['StopMovieRecording']();
+}
+
+export function StopRewind() {
+  return window['go']['main']['App']['StopRewind']();
+}
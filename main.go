@@ -6,9 +6,7 @@ import (
 	"log"
 	"net/http"
 	_ "net/http/pprof"
-	"os"
 
-	"github.com/jonathangjertsen/toyboy/model"
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/logger"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -35,20 +33,6 @@ func main() {
 		}()
 	}
 
-	if len(os.Args) == 2 && os.Args[1] == "debug" {
-		clk := model.NewClock()
-		var gb model.Gameboy
-		gb.AllocMem()
-		gb.Init(&config.Model, clk)
-
-		if err := model.LoadROM("assets/cartridges/unbricked.gb", &gb); err != nil {
-			panic(err)
-		}
-
-		clk.Start()
-		select {}
-	}
-
 	// Create an instance of the app structure
 	app := NewApp(&config)
 
@@ -16,3 +16,10 @@ func AudioStub() (Audio, chan []AudioSample) {
 	}
 	return audio, devnull
 }
+
+// Discards everything
+type AudioSilent struct{}
+
+func (AudioSilent) Clock(*APU) {}
+
+func (AudioSilent) SetMPeriod(time.Duration) {}
@@ -0,0 +1,144 @@
+package model
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Size of the RTC footer appended to MBC3 saves by BGB, VBA-M, SameBoy, mGBA etc.
+// 5 live registers and 5 latched registers as little-endian uint32, followed by a UNIX timestamp.
+// The timestamp is 64-bit in the current format, older emulators wrote it as 32-bit.
+const (
+	RTCFooterSize      = 48
+	RTCFooterSizeShort = 44
+)
+
+// Path of the battery save belonging to a ROM, i.e. "game.gb" => "game.sav"
+func BatterySavePath(romPath string) string {
+	return strings.TrimSuffix(romPath, filepath.Ext(romPath)) + ".sav"
+}
+
+// Loads the battery save from the cartridge's BatteryPath.
+// A missing file is not an error, it just means the game has not been saved yet.
+func (gb *Gameboy) LoadBattery() error {
+	cart := &gb.Cartridge
+	if !cart.MBCFeatures.Battery || cart.BatteryPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(cart.BatteryPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading battery save: %w", err)
+	}
+	if err := gb.DecodeBattery(data, time.Now()); err != nil {
+		return fmt.Errorf("battery save %s: %w", cart.BatteryPath, err)
+	}
+	return nil
+}
+
+// Writes the battery save if cartridge RAM has been written since the last save
+func (gb *Gameboy) FlushBattery() error {
+	if !gb.Cartridge.BatteryDirty {
+		return nil
+	}
+	return gb.SaveBattery()
+}
+
+// Writes the battery save to the cartridge's BatteryPath
+func (gb *Gameboy) SaveBattery() error {
+	cart := &gb.Cartridge
+	if !cart.MBCFeatures.Battery || cart.BatteryPath == "" {
+		return nil
+	}
+
+	// Write to a temporary file first so that a crash while saving doesn't destroy the old save
+	tmp := cart.BatteryPath + ".tmp"
+	if err := os.WriteFile(tmp, gb.EncodeBattery(time.Now()), 0o666); err != nil {
+		return fmt.Errorf("writing battery save: %w", err)
+	}
+	if err := os.Rename(tmp, cart.BatteryPath); err != nil {
+		return fmt.Errorf("writing battery save: %w", err)
+	}
+	cart.BatteryDirty = false
+	return nil
+}
+
+// Encodes cartridge RAM in the raw layout used by other emulators: all RAM banks back to back,
+// followed by the RTC footer for MBC3 carts with a clock.
+func (gb *Gameboy) EncodeBattery(now time.Time) []byte {
+	cart := &gb.Cartridge
+	mbc := &cart.MBCFeatures
+
+	out := make([]byte, 0, mbc.TotalRAMSize()+RTCFooterSize)
+	if mbc.ID == MBCID2 {
+		out = append(out, ByteSlice(cart.RAM[0][:MBC2RAMSize])...)
+	} else {
+		for bank := range mbc.NRAMBanks {
+			out = append(out, ByteSlice(cart.RAM[bank][:])...)
+		}
+	}
+
+	if mbc.ID == MBCID3 && mbc.RTC {
+		var footer [RTCFooterSize]byte
+		for i := range NRTCRegs {
+			binary.LittleEndian.PutUint32(footer[i*4:], uint32(cart.RTC.Live[i]))
+			binary.LittleEndian.PutUint32(footer[(NRTCRegs+i)*4:], uint32(cart.RTC.Latched[i]))
+		}
+		binary.LittleEndian.PutUint64(footer[NRTCRegs*8:], uint64(now.Unix()))
+		out = append(out, footer[:]...)
+	}
+	return out
+}
+
+// Decodes a battery save produced by EncodeBattery or another emulator.
+// The RTC is advanced by the wall-clock time that has passed since the save was written.
+func (gb *Gameboy) DecodeBattery(data []byte, now time.Time) error {
+	cart := &gb.Cartridge
+	mbc := &cart.MBCFeatures
+
+	ramSize := mbc.TotalRAMSize()
+	if len(data) < ramSize {
+		return fmt.Errorf("expected at least %d bytes, got %d", ramSize, len(data))
+	}
+
+	if mbc.ID == MBCID2 {
+		for i := range MBC2RAMSize {
+			cart.RAM[0][i] = Data8(data[i] & 0x0f)
+		}
+	} else {
+		for bank := range mbc.NRAMBanks {
+			copy(cart.RAM[bank][:], Data8Slice(data[bank*RAMBankSize:(bank+1)*RAMBankSize]))
+		}
+	}
+
+	footer := data[ramSize:]
+	if !(mbc.ID == MBCID3 && mbc.RTC) || len(footer) == 0 {
+		return nil
+	}
+
+	var timestamp int64
+	switch len(footer) {
+	case RTCFooterSize:
+		timestamp = int64(binary.LittleEndian.Uint64(footer[NRTCRegs*8:]))
+	case RTCFooterSizeShort:
+		timestamp = int64(binary.LittleEndian.Uint32(footer[NRTCRegs*8:]))
+	default:
+		return fmt.Errorf("RTC footer has unexpected size %d", len(footer))
+	}
+	for i := range NRTCRegs {
+		cart.RTC.Live[i] = Data8(binary.LittleEndian.Uint32(footer[i*4:])) & rtcRegMasks[i]
+		cart.RTC.Latched[i] = Data8(binary.LittleEndian.Uint32(footer[(NRTCRegs+i)*4:])) & rtcRegMasks[i]
+	}
+	if elapsed := now.Unix() - timestamp; elapsed > 0 {
+		cart.RTC.Advance(uint64(elapsed))
+	}
+	return nil
+}
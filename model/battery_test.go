@@ -0,0 +1,165 @@
+package model_test
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jonathangjertsen/toyboy/model"
+)
+
+func fillCartridgeRAM(gb *model.Gameboy) {
+	for bank := range gb.Cartridge.MBCFeatures.NRAMBanks {
+		for i := range model.RAMBankSize {
+			gb.Cartridge.RAM[bank][i] = model.Data8(bank*7 + i)
+		}
+	}
+}
+
+func TestBatterySRAM(t *testing.T) {
+	// MBC5+RAM+BATTERY, 32 KiB RAM
+	gb, _ := newCartridgeGameboy(0x1b, 0x02, 0x03)
+	fillCartridgeRAM(gb)
+	now := time.Unix(1_700_000_000, 0)
+	data := gb.EncodeBattery(now)
+	if len(data) != 4*model.RAMBankSize {
+		t.Fatalf("want %d bytes, have %d", 4*model.RAMBankSize, len(data))
+	}
+
+	loaded, _ := newCartridgeGameboy(0x1b, 0x02, 0x03)
+	if err := loaded.DecodeBattery(data, now); err != nil {
+		t.Fatal(err)
+	}
+	for bank := range 4 {
+		if loaded.Cartridge.RAM[bank] != gb.Cartridge.RAM[bank] {
+			t.Fatalf("bank %d differs after round trip", bank)
+		}
+	}
+
+	// Extra bytes are ignored on carts without a clock
+	if err := loaded.DecodeBattery(append(data, 1, 2, 3), now); err != nil {
+		t.Fatalf("want oversized save accepted, have %v", err)
+	}
+	if err := loaded.DecodeBattery(data[:len(data)-1], now); err == nil {
+		t.Fatalf("want truncated save rejected")
+	}
+}
+
+func TestBatteryMBC2(t *testing.T) {
+	gb, _ := newCartridgeGameboy(0x06, 0x03, 0x00)
+	for i := range model.MBC2RAMSize {
+		gb.Cartridge.RAM[0][i] = model.Data8(i) & 0x0f
+	}
+	data := gb.EncodeBattery(time.Now())
+	if len(data) != model.MBC2RAMSize {
+		t.Fatalf("want %d bytes, have %d", model.MBC2RAMSize, len(data))
+	}
+
+	// Other emulators may store the upper nibble as 1s
+	for i := range data {
+		data[i] |= 0xf0
+	}
+	loaded, _ := newCartridgeGameboy(0x06, 0x03, 0x00)
+	if err := loaded.DecodeBattery(data, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Cartridge.RAM[0] != gb.Cartridge.RAM[0] {
+		t.Fatalf("RAM differs after round trip")
+	}
+}
+
+func TestBatteryRTC(t *testing.T) {
+	newGB := func() *model.Gameboy {
+		// MBC3+TIMER+RAM+BATTERY, 8 KiB RAM
+		gb, _ := newCartridgeGameboy(0x10, 0x02, 0x02)
+		return gb
+	}
+	gb := newGB()
+	fillCartridgeRAM(gb)
+	setRTC(&gb.Cartridge.RTC, 3, 4, 5, 6)
+	gb.Cartridge.RTC.Latch()
+	setRTC(&gb.Cartridge.RTC, 3, 4, 5, 7)
+
+	saved := time.Unix(1_700_000_000, 0)
+	data := gb.EncodeBattery(saved)
+	if len(data) != model.RAMBankSize+model.RTCFooterSize {
+		t.Fatalf("want %d bytes, have %d", model.RAMBankSize+model.RTCFooterSize, len(data))
+	}
+	// The 44-byte footer has a 32-bit timestamp
+	short := append([]byte{}, data[:model.RAMBankSize+40]...)
+	short = binary.LittleEndian.AppendUint32(short, uint32(saved.Unix()))
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{name: "48-byte footer", data: data},
+		{name: "44-byte footer", data: short},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			loaded := newGB()
+			if err := loaded.DecodeBattery(tc.data, saved.Add(61*time.Second)); err != nil {
+				t.Fatal(err)
+			}
+			if loaded.Cartridge.RAM[0] != gb.Cartridge.RAM[0] {
+				t.Fatalf("RAM differs after round trip")
+			}
+			rtc := &loaded.Cartridge.RTC
+			checkRTC(t, rtc, 3, 4, 6, 8)
+			if rtc.Latched != gb.Cartridge.RTC.Latched {
+				t.Fatalf("want latched registers restored, have %v", rtc.Latched)
+			}
+		})
+	}
+
+	t.Run("no footer", func(t *testing.T) {
+		loaded := newGB()
+		if err := loaded.DecodeBattery(data[:model.RAMBankSize], saved); err != nil {
+			t.Fatal(err)
+		}
+		checkRTC(t, &loaded.Cartridge.RTC, 0, 0, 0, 0)
+	})
+
+	t.Run("clock went backwards", func(t *testing.T) {
+		loaded := newGB()
+		if err := loaded.DecodeBattery(data, saved.Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		checkRTC(t, &loaded.Cartridge.RTC, 3, 4, 5, 7)
+	})
+
+	for _, n := range []int{model.RAMBankSize - 1, model.RAMBankSize + 10, model.RAMBankSize + model.RTCFooterSize + 1} {
+		buf := make([]byte, n)
+		copy(buf, data)
+		if err := newGB().DecodeBattery(buf, saved); err == nil {
+			t.Fatalf("want %d-byte save rejected", n)
+		}
+	}
+}
+
+func TestBatteryFile(t *testing.T) {
+	gb, _ := newCartridgeGameboy(0x1b, 0x02, 0x03)
+	gb.Cartridge.BatteryPath = filepath.Join(t.TempDir(), "game.sav")
+
+	loaded, _ := newCartridgeGameboy(0x1b, 0x02, 0x03)
+	loaded.Cartridge.BatteryPath = gb.Cartridge.BatteryPath
+	if err := loaded.LoadBattery(); err != nil {
+		t.Fatalf("want missing save accepted, have %v", err)
+	}
+
+	fillCartridgeRAM(gb)
+	gb.Cartridge.BatteryDirty = true
+	if err := gb.FlushBattery(); err != nil {
+		t.Fatal(err)
+	}
+	if gb.Cartridge.BatteryDirty {
+		t.Fatalf("want clean after saving")
+	}
+	if err := loaded.LoadBattery(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Cartridge.RAM[3] != gb.Cartridge.RAM[3] {
+		t.Fatalf("RAM differs after saving and loading")
+	}
+}
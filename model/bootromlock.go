@@ -15,10 +15,9 @@ func (gb *Gameboy) WriteBootROMLock(v Data8) {
 
 func (gb *Gameboy) LockBootROM() {
 	gb.BootROMLock.BootOff = true
-	copy(gb.Mem[:SizeBootROM], gb.Cartridge.ROM[0][:SizeBootROM])
 
 	// Update debug
-	gb.Debug.SetProgram(gb.Mem[:AddrCartridgeBankNEnd])
+	gb.Debug.SetProgram(gb.CartridgeProgram())
 
 	// Explore from known entry points (Cartridge entrypoint and interrupt vector)
 	gb.Debug.Disassembler.SetPC(0x100)
@@ -28,3 +27,61 @@ func (gb *Gameboy) LockBootROM() {
 	gb.Debug.Disassembler.SetPC(0x58)
 	gb.Debug.Disassembler.SetPC(0x60)
 }
+
+// Snapshot of the currently mapped ROM banks as seen from 0x0000-0x7fff
+func (gb *Gameboy) CartridgeProgram() []Data8 {
+	cart := &gb.Cartridge
+	program := make([]Data8, 0, 2*ROMBankSize)
+	program = append(program, cart.ROM[cart.SelectedROMBank0][:]...)
+	program = append(program, cart.ROM[cart.SelectedROMBank1][:]...)
+	return program
+}
+
+// I/O register values left behind by the DMG boot ROM, in the order they are written
+var postBootIO = []struct {
+	Addr  Addr
+	Value Data8
+}{
+	{AddrNR52, 0xf1},
+	{AddrNR10, 0x80},
+	{AddrNR11, 0xbf},
+	{AddrNR12, 0xf3},
+	{AddrNR14, 0xbf},
+	{AddrNR21, 0x3f},
+	{AddrNR24, 0xbf},
+	{AddrNR30, 0x7f},
+	{AddrNR31, 0xff},
+	{AddrNR32, 0x9f},
+	{AddrNR34, 0xbf},
+	{AddrNR41, 0xff},
+	{AddrNR44, 0xbf},
+	{AddrNR50, 0x77},
+	{AddrNR51, 0xf3},
+	{AddrBGP, 0xfc},
+	{AddrLCDC, 0x91},
+	{AddrBootROMLock, 0x01},
+}
+
+// Put the machine in the state the DMG boot ROM leaves it in, ready to execute the cartridge entry point.
+// Must be called after the cartridge is loaded.
+func (gb *Gameboy) SkipBootROM() {
+	for _, reg := range postBootIO {
+		gb.WriteAddress(reg.Addr)
+		gb.WriteData(reg.Value)
+	}
+	gb.Mem[AddrIF] = 0xe1
+	gb.Timer.DIV = 0xabcc
+
+	regs := &gb.CPU.Regs
+	regs.A, regs.F = 0x01, 0xb0
+	regs.B, regs.C = 0x00, 0x13
+	regs.D, regs.E = 0x00, 0xd8
+	regs.H, regs.L = 0x01, 0x4d
+	regs.SP = 0xfffe
+
+	// Pretend the boot ROM's last instruction is still executing, so that the next fetch is the entry point
+	regs.PC = AddrCartridgeEntryPoint
+	regs.IR = OpcodeNop
+	gb.CPU.UOpCycle = 1
+	gb.CPU.FetchPending = false
+}
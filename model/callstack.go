@@ -0,0 +1,70 @@
+package model
+
+import (
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Subroutine call or interrupt dispatch that hasn't returned yet
+type CallFrame struct {
+	// Called address or interrupt vector
+	Target Addr
+	// Address pushed on the stack
+	Return Addr
+	// Stack pointer right after the return address was pushed
+	SP        Addr
+	Interrupt bool
+}
+
+// Code that resets SP instead of returning would otherwise grow the call stack forever
+const maxCallDepth = 256
+
+// Called when the CPU is done with an instruction or interrupt dispatch, before the next fetch.
+// Frames are dropped when SP moves above them, which covers RET, RETI and code that pops its return address.
+func (dbg *Debugger) trackCalls(gb *Gameboy, irq bool) {
+	if dbg == nil {
+		return
+	}
+	regs := &gb.CPU.Regs
+	for n := len(dbg.Calls); n > 0 && dbg.Calls[n-1].SP < regs.SP; n-- {
+		dbg.Calls = dbg.Calls[:n-1]
+	}
+	if !irq && !isCall(regs.IR, gb.CPU.LastBranchResult) {
+		return
+	}
+	if len(dbg.Calls) == maxCallDepth {
+		dbg.Calls = slices.Delete(dbg.Calls, 0, 1)
+	}
+	dbg.Calls = append(dbg.Calls, CallFrame{
+		Target:    regs.PC,
+		Return:    Addr(join16(gb.Mem[regs.SP+1], gb.Mem[regs.SP])),
+		SP:        regs.SP,
+		Interrupt: irq,
+	})
+}
+
+func isCall(op Opcode, branchResult int) bool {
+	switch op {
+	case OpcodeCALLnn, OpcodeRST0x00, OpcodeRST0x08, OpcodeRST0x10, OpcodeRST0x18, OpcodeRST0x20, OpcodeRST0x28, OpcodeRST0x30, OpcodeRST0x38:
+		return true
+	case OpcodeCALLZnn, OpcodeCALLNZnn, OpcodeCALLCnn, OpcodeCALLNCnn:
+		return branchResult == +1
+	}
+	return false
+}
+
+// Prints the current location followed by the return address of each frame, innermost first
+func (gb *Gameboy) PrintCallStack(w io.Writer) {
+	inst, _ := gb.CPU.CurrInstruction()
+	fmt.Fprintf(w, "#0 [PC=%s] %s\n", inst.Address.Hex(), gb.LabelOffset(inst.Address))
+	calls := gb.Debug.Calls
+	for i := len(calls) - 1; i >= 0; i-- {
+		frame := calls[i]
+		kind := "call"
+		if frame.Interrupt {
+			kind = "interrupt"
+		}
+		fmt.Fprintf(w, "#%d [PC=%s] %s (%s to %s)\n", len(calls)-i, frame.Return.Hex(), gb.LabelOffset(frame.Return), kind, gb.LabelOffset(frame.Target))
+	}
+}
@@ -13,27 +13,27 @@ type Cartridge struct {
 	RegLow           Data8
 	RegHigh          Data8
 	RegSelect        Data8
+	RegROMBankHigh   Data8
 	SelectedRAMBank  Data8
-	SelectedROMBank0 Data8
-	SelectedROMBank1 Data8
+	SelectedROMBank0 Data16
+	SelectedROMBank1 Data16
+	RTC              RTC
+	RumbleOn         bool
+	BatteryPath      string
+	BatteryDirty     bool
 }
 
-func (gb *Gameboy) SetROMBank0(which Data8) {
-	if which >= Data8(gb.Cartridge.MBCFeatures.NROMBanks) {
+func (gb *Gameboy) SetROMBank0(which Data16) {
+	if which >= Data16(gb.Cartridge.MBCFeatures.NROMBanks) {
 		return
 	}
-
-	fmt.Printf("Switched bank 0\n")
-	copy(gb.Mem[AddrZero:AddrCartridgeBank0End], gb.Cartridge.ROM[which][:])
 	gb.Cartridge.SelectedROMBank0 = which
 }
 
-func (gb *Gameboy) SetROMBank1(which Data8) {
-	if which >= Data8(gb.Cartridge.MBCFeatures.NROMBanks) {
+func (gb *Gameboy) SetROMBank1(which Data16) {
+	if which >= Data16(gb.Cartridge.MBCFeatures.NROMBanks) {
 		return
 	}
-	fmt.Printf("Switched bank 1\n")
-	copy(gb.Mem[AddrCartridgeBankNBegin:AddrCartridgeBankNEnd], gb.Cartridge.ROM[which][:])
 	gb.Cartridge.SelectedROMBank1 = which
 }
 
@@ -41,22 +41,34 @@ func (gb *Gameboy) SetRAMBank(which Data8) {
 	if which >= Data8(gb.Cartridge.MBCFeatures.NRAMBanks) {
 		return
 	}
-	fmt.Printf("Switched RAM bank\n")
-
-	// Store current RAM contents to bank
-	copy(gb.Cartridge.RAM[gb.Cartridge.SelectedRAMBank][:], gb.Mem[AddrCartridgeRAMBegin:AddrCartridgeRAMEnd])
-
-	// Load from bank to RAM
-	copy(gb.Mem[AddrCartridgeRAMBegin:AddrCartridgeRAMEnd], gb.Cartridge.RAM[which][:])
 	gb.Cartridge.SelectedRAMBank = which
 }
 
+// Bank switching only changes which bank is accessed here and in ReadCartridgeRAM/WriteCartridgeRAM,
+// so Cartridge.ROM and Cartridge.RAM always hold the authoritative contents.
+func (gb *Gameboy) ReadCartridgeROM(addr Addr) Data8 {
+	cart := &gb.Cartridge
+	if addr <= AddrBootROMEnd && !gb.BootROMLock.BootOff {
+		return gb.Mem[addr]
+	}
+	if addr <= AddrCartridgeBank0End {
+		return cart.ROM[cart.SelectedROMBank0][addr]
+	}
+	return cart.ROM[cart.SelectedROMBank1][addr-AddrCartridgeBankNBegin]
+}
+
 func (gb *Gameboy) WriteCartridge(addr Addr, v Data8) {
 	switch gb.Cartridge.MBCFeatures.ID {
 	case MBCIDNone:
 		return
 	case MBCID1:
 		gb.writeCartridgeMBC1(addr, v)
+	case MBCID2:
+		gb.writeCartridgeMBC2(addr, v)
+	case MBCID3:
+		gb.writeCartridgeMBC3(addr, v)
+	case MBCID5:
+		gb.writeCartridgeMBC5(addr, v)
 	default:
 		panic("not implemented MBC")
 	}
@@ -115,8 +127,136 @@ func (gb *Gameboy) updateBankMBC1() {
 	ramBank &= (count - 1)
 
 	gb.SetRAMBank(Data8(ramBank))
-	gb.SetROMBank0(Data8(romBank0))
-	gb.SetROMBank1(Data8(romBank1))
+	gb.SetROMBank0(romBank0)
+	gb.SetROMBank1(romBank1)
+}
+
+func (gb *Gameboy) writeCartridgeMBC2(addr Addr, v Data8) {
+	cart := &gb.Cartridge
+	if addr > 0x3fff {
+		return
+	}
+	// Bit 8 of the address selects between RAM enable and ROM bank select
+	if addr&0x100 == 0 {
+		cart.ExtRAMEnabled = v&0x0f == 0x0a
+	} else {
+		v &= 0x0f
+		if v == 0x00 {
+			v = 0x01
+		}
+		cart.RegLow = v
+		gb.SetROMBank1(Data16(v) & Data16(cart.MBCFeatures.NROMBanks-1))
+	}
+}
+
+func (gb *Gameboy) writeCartridgeMBC3(addr Addr, v Data8) {
+	cart := &gb.Cartridge
+	if addr <= 0x1fff {
+		// Enables both RAM and RTC registers
+		cart.ExtRAMEnabled = v&0x0f == 0x0a
+	} else if addr <= 0x3fff {
+		v &= 0x7f
+		if v == 0x00 {
+			v = 0x01
+		}
+		cart.RegLow = v
+		gb.SetROMBank1(Data16(v) & Data16(cart.MBCFeatures.NROMBanks-1))
+	} else if addr <= 0x5fff {
+		// 0x00-0x07 selects a RAM bank, 0x08-0x0c selects an RTC register
+		cart.RegHigh = v
+		if v < RTCSelectBegin && cart.MBCFeatures.NRAMBanks > 0 {
+			gb.SetRAMBank(v & Data8(cart.MBCFeatures.NRAMBanks-1))
+		}
+	} else if addr <= 0x7fff {
+		// Writing 0x00 then 0x01 latches the clock
+		if cart.RegSelect == 0x00 && v == 0x01 {
+			cart.RTC.Latch()
+		}
+		cart.RegSelect = v
+	}
+}
+
+func (gb *Gameboy) writeCartridgeMBC5(addr Addr, v Data8) {
+	cart := &gb.Cartridge
+	if addr <= 0x1fff {
+		cart.ExtRAMEnabled = v&0x0f == 0x0a
+	} else if addr <= 0x2fff {
+		// Lower 8 bits of ROM bank. Unlike MBC1/MBC3, bank 0 can be mapped into 0x4000-0x7fff
+		cart.RegLow = v
+		gb.updateBankMBC5()
+	} else if addr <= 0x3fff {
+		// 9th bit of ROM bank
+		cart.RegROMBankHigh = v & 0x01
+		gb.updateBankMBC5()
+	} else if addr <= 0x5fff {
+		cart.RegHigh = v
+		ramBank := v & 0x0f
+		if cart.MBCFeatures.Rumble {
+			// Bit 3 drives the rumble motor instead of selecting a RAM bank
+			cart.RumbleOn = v&Bit3 != 0
+			ramBank &= 0x07
+		}
+		if cart.MBCFeatures.NRAMBanks > 0 {
+			gb.SetRAMBank(ramBank & Data8(cart.MBCFeatures.NRAMBanks-1))
+		}
+	}
+}
+
+func (gb *Gameboy) updateBankMBC5() {
+	cart := &gb.Cartridge
+	romBank := join16(cart.RegROMBankHigh, cart.RegLow)
+	gb.SetROMBank1(romBank & Data16(cart.MBCFeatures.NROMBanks-1))
+}
+
+func (cart *Cartridge) rtcSelected() bool {
+	return cart.MBCFeatures.ID == MBCID3 && cart.RegHigh >= RTCSelectBegin
+}
+
+func (gb *Gameboy) ReadCartridgeRAM(addr Addr) Data8 {
+	cart := &gb.Cartridge
+	if cart.MBCFeatures.ID == MBCIDNone {
+		return cart.RAM[0][addr-AddrCartridgeRAMBegin]
+	}
+	if !cart.ExtRAMEnabled {
+		return 0xff
+	}
+	if cart.MBCFeatures.ID == MBCID2 {
+		// Only the lower nibble is backed by RAM, and the 512 cells are echoed throughout the region
+		return 0xf0 | cart.RAM[0][addr&(MBC2RAMSize-1)]
+	}
+	if cart.rtcSelected() {
+		return cart.RTC.Read(cart.RegHigh)
+	}
+	if cart.MBCFeatures.NRAMBanks == 0 {
+		return 0xff
+	}
+	return cart.RAM[cart.SelectedRAMBank][addr-AddrCartridgeRAMBegin]
+}
+
+func (gb *Gameboy) WriteCartridgeRAM(addr Addr, v Data8) {
+	cart := &gb.Cartridge
+	if cart.MBCFeatures.ID == MBCIDNone {
+		cart.RAM[0][addr-AddrCartridgeRAMBegin] = v
+		return
+	}
+	if !cart.ExtRAMEnabled {
+		return
+	}
+	if cart.MBCFeatures.ID == MBCID2 {
+		cart.RAM[0][addr&(MBC2RAMSize-1)] = v & 0x0f
+		cart.BatteryDirty = true
+		return
+	}
+	if cart.rtcSelected() {
+		cart.RTC.Write(cart.RegHigh, v)
+		cart.BatteryDirty = true
+		return
+	}
+	if cart.MBCFeatures.NRAMBanks == 0 {
+		return
+	}
+	cart.RAM[cart.SelectedRAMBank][addr-AddrCartridgeRAMBegin] = v
+	cart.BatteryDirty = true
 }
 
 func (gb *Gameboy) PrintCartridgeInfo(f io.Writer) {
@@ -128,17 +268,28 @@ func (gb *Gameboy) PrintCartridgeInfo(f io.Writer) {
 	fmt.Fprintf(f, "RAM size: %d kB (%d banks)\n", mbc.TotalRAMSize()/1024, mbc.NRAMBanks)
 	fmt.Fprintf(f, "Features: %s\n", mbc.Features())
 	fmt.Fprintf(f, "HIGH=%s LOW=%s SEL=%s\n", cart.RegHigh.Hex(), cart.RegLow.Hex(), cart.RegSelect.Hex())
+	fmt.Fprintf(f, "ROM0=%d ROM1=%d RAM=%d\n", cart.SelectedROMBank0, cart.SelectedROMBank1, cart.SelectedRAMBank)
+	if mbc.Rumble {
+		fmt.Fprintf(f, "Rumble: %d\n", b2i(cart.RumbleOn))
+	}
+	if mbc.RTC {
+		rtc := &cart.RTC
+		fmt.Fprintf(f, "RTC: %dd %02d:%02d:%02d halt=%d carry=%d\n",
+			rtc.Days(), rtc.Live[RTCRegH], rtc.Live[RTCRegM], rtc.Live[RTCRegS],
+			b2i(rtc.Halted()), b2i(rtc.Live[RTCRegDH]&RTCDHCarry != 0))
+	}
 
 }
 
 func (gb *Gameboy) CartridgeTitle() string {
+	bank0 := gb.Cartridge.ROM[0][:]
 	titleStart := 0x134
 	titleEnd := titleStart + 16
 	for i := range 16 {
 		titleEnd = titleStart + i
-		if gb.Mem[titleStart+i] == 0 {
+		if bank0[titleStart+i] == 0 {
 			break
 		}
 	}
-	return string(gb.Mem[titleStart:titleEnd])
+	return string(bank0[titleStart:titleEnd])
 }
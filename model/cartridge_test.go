@@ -0,0 +1,275 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/jonathangjertsen/toyboy/model"
+)
+
+// Gameboy with a cartridge described by the given header bytes.
+// The first two bytes of each ROM bank hold the bank number.
+func newCartridgeGameboy(cartType, romSize, ramSize uint8) (*model.Gameboy, *model.ClockRT) {
+	gb, clk := newDebuggerGameboy()
+	gb.Cartridge.MBCFeatures = model.GetMBCFeatures(cartType, romSize, ramSize)
+	for bank := range gb.Cartridge.MBCFeatures.NROMBanks {
+		gb.Cartridge.ROM[bank][0] = model.Data8(bank)
+		gb.Cartridge.ROM[bank][1] = model.Data8(bank >> 8)
+	}
+	gb.SetROMBank1(1)
+	return gb, clk
+}
+
+// Bank number mapped into 0x4000-0x7fff
+func mappedROMBank(gb *model.Gameboy) int {
+	return int(gb.ReadCartridgeROM(0x4000)) | int(gb.ReadCartridgeROM(0x4001))<<8
+}
+
+func TestMBC3ROMBank(t *testing.T) {
+	// MBC3+TIMER+RAM+BATTERY, 2 MiB ROM, 32 KiB RAM
+	gb, _ := newCartridgeGameboy(0x10, 0x06, 0x03)
+	for _, tc := range []struct {
+		v    model.Data8
+		want int
+	}{
+		{v: 0x05, want: 5},
+		{v: 0x00, want: 1},
+		{v: 0x7f, want: 127},
+		{v: 0x85, want: 5},
+	} {
+		gb.WriteCartridge(0x2000, tc.v)
+		if have := mappedROMBank(gb); have != tc.want {
+			t.Fatalf("wrote %s: want bank %d have %d", tc.v.Hex(), tc.want, have)
+		}
+	}
+}
+
+func TestMBC3RAMAndRTCSelect(t *testing.T) {
+	gb, _ := newCartridgeGameboy(0x10, 0x06, 0x03)
+	cart := &gb.Cartridge
+
+	gb.WriteCartridge(0x4000, 0x02)
+	gb.WriteCartridgeRAM(0xa000, 0x42)
+	if have := gb.ReadCartridgeRAM(0xa000); have != 0xff {
+		t.Fatalf("want $FF with RAM disabled, have %s", have.Hex())
+	}
+	gb.WriteCartridge(0x0000, 0x0a)
+	gb.WriteCartridgeRAM(0xa000, 0x42)
+	if cart.RAM[2][0] != 0x42 {
+		t.Fatalf("want write to RAM bank 2")
+	}
+
+	// Selecting an RTC register maps it over the whole region without touching RAM
+	gb.WriteCartridge(0x4000, 0x08)
+	gb.WriteCartridgeRAM(0xbfff, 30)
+	if cart.RTC.Live[model.RTCRegS] != 30 || cart.RAM[2][0x1fff] != 0 {
+		t.Fatalf("want write to RTC seconds, have S=%d", cart.RTC.Live[model.RTCRegS])
+	}
+	if have := gb.ReadCartridgeRAM(0xa123); have != 30 {
+		t.Fatalf("want RTC seconds, have %d", have)
+	}
+	gb.WriteCartridge(0x4000, 0x0c)
+	gb.WriteCartridgeRAM(0xa000, 0xff)
+	if cart.RTC.Live[model.RTCRegDH] != model.RTCDHDayMSB|model.RTCDHHalt|model.RTCDHCarry {
+		t.Fatalf("want unused DH bits masked, have %s", cart.RTC.Live[model.RTCRegDH].Hex())
+	}
+
+	gb.WriteCartridge(0x4000, 0x02)
+	if have := gb.ReadCartridgeRAM(0xa000); have != 0x42 {
+		t.Fatalf("want RAM bank 2 mapped back in, have %s", have.Hex())
+	}
+	gb.WriteCartridge(0x0000, 0x00)
+	gb.WriteCartridge(0x4000, 0x08)
+	if have := gb.ReadCartridgeRAM(0xa000); have != 0xff {
+		t.Fatalf("want $FF with RTC disabled, have %s", have.Hex())
+	}
+}
+
+func TestMBC3Latch(t *testing.T) {
+	gb, _ := newCartridgeGameboy(0x10, 0x06, 0x03)
+	rtc := &gb.Cartridge.RTC
+	gb.WriteCartridge(0x0000, 0x0a)
+	gb.WriteCartridge(0x4000, 0x08)
+	seconds := func() model.Data8 { return gb.ReadCartridgeRAM(0xa000) }
+
+	rtc.Advance(5)
+	if have := seconds(); have != 0 {
+		t.Fatalf("want latched value before latching, have %d", have)
+	}
+	gb.WriteCartridge(0x6000, 0x00)
+	gb.WriteCartridge(0x6000, 0x01)
+	if have := seconds(); have != 5 {
+		t.Fatalf("want 5 after latching, have %d", have)
+	}
+
+	rtc.Advance(5)
+	gb.WriteCartridge(0x6000, 0x01)
+	if have := seconds(); have != 5 {
+		t.Fatalf("want no latch on 1 -> 1, have %d", have)
+	}
+	gb.WriteCartridge(0x6000, 0x02)
+	gb.WriteCartridge(0x6000, 0x01)
+	if have := seconds(); have != 5 {
+		t.Fatalf("want no latch on 2 -> 1, have %d", have)
+	}
+	gb.WriteCartridge(0x6000, 0x00)
+	gb.WriteCartridge(0x6000, 0x01)
+	if have := seconds(); have != 10 {
+		t.Fatalf("want 10 after latching, have %d", have)
+	}
+}
+
+func TestMBC5ROMBank(t *testing.T) {
+	// MBC5+RAM+BATTERY, 8 MiB ROM, 128 KiB RAM
+	gb, _ := newCartridgeGameboy(0x1b, 0x08, 0x04)
+	for _, tc := range []struct {
+		addr model.Addr
+		v    model.Data8
+		want int
+	}{
+		{addr: 0x2000, v: 0x05, want: 5},
+		{addr: 0x2fff, v: 0xff, want: 0xff},
+		{addr: 0x3000, v: 0x01, want: 0x1ff},
+		{addr: 0x2000, v: 0x23, want: 0x123},
+		// Only bit 0 of the high register is used
+		{addr: 0x3fff, v: 0xfe, want: 0x23},
+		// Bank 0 can be mapped in
+		{addr: 0x2000, v: 0x00, want: 0},
+	} {
+		gb.WriteCartridge(tc.addr, tc.v)
+		if have := mappedROMBank(gb); have != tc.want {
+			t.Fatalf("wrote %s to %s: want bank %d have %d", tc.v.Hex(), tc.addr.Hex(), tc.want, have)
+		}
+	}
+	if have := gb.ReadCartridgeROM(0x0150); have != 0 {
+		t.Fatalf("want bank 0 at 0x0000-0x3fff, have %s", have.Hex())
+	}
+
+	// Smaller ROMs ignore the upper bits
+	gb, _ = newCartridgeGameboy(0x19, 0x02, 0x00)
+	gb.WriteCartridge(0x3000, 0x01)
+	gb.WriteCartridge(0x2000, 0x0a)
+	if have := mappedROMBank(gb); have != 2 {
+		t.Fatalf("want bank 2 in a 8-bank ROM, have %d", have)
+	}
+}
+
+func TestMBC5RAMBank(t *testing.T) {
+	gb, _ := newCartridgeGameboy(0x1b, 0x08, 0x04)
+	gb.WriteCartridge(0x0000, 0x0a)
+	for bank := range 16 {
+		gb.WriteCartridge(0x4000, model.Data8(bank))
+		gb.WriteCartridgeRAM(0xa000, model.Data8(0x80|bank))
+	}
+	for bank := range 16 {
+		if have := gb.Cartridge.RAM[bank][0]; have != model.Data8(0x80|bank) {
+			t.Fatalf("bank %d: want %02x have %s", bank, 0x80|bank, have.Hex())
+		}
+		gb.WriteCartridge(0x4000, model.Data8(bank))
+		if have := gb.ReadCartridgeRAM(0xa000); have != model.Data8(0x80|bank) {
+			t.Fatalf("bank %d: want %02x have %s", bank, 0x80|bank, have.Hex())
+		}
+	}
+	if gb.Cartridge.RumbleOn {
+		t.Fatalf("want no rumble on a cart without a motor")
+	}
+}
+
+func TestMBC5Rumble(t *testing.T) {
+	// MBC5+RUMBLE+RAM, 32 KiB RAM
+	gb, clk := newCartridgeGameboy(0x1d, 0x02, 0x03)
+	audio, devnull := model.AudioStub()
+	defer close(devnull)
+	fs := model.FrameSync{}
+	var events []bool
+	clk.AttachRumbleListener(func(on bool) { events = append(events, on) })
+
+	gb.WriteCartridge(0x0000, 0x0a)
+	gb.WriteCartridge(0x4000, 0x03)
+	gb.WriteCartridgeRAM(0xa000, 0x33)
+	gb.WriteCartridge(0x4000, 0x0b)
+	if !gb.Cartridge.RumbleOn || gb.Cartridge.SelectedRAMBank != 3 {
+		t.Fatalf("want rumble on and RAM bank 3, have rumble=%v bank=%d", gb.Cartridge.RumbleOn, gb.Cartridge.SelectedRAMBank)
+	}
+	if have := gb.ReadCartridgeRAM(0xa000); have != 0x33 {
+		t.Fatalf("want bit 3 ignored for RAM bank select, have %s", have.Hex())
+	}
+	clk.MCycle(1, gb, audio, &fs)
+	gb.WriteCartridge(0x4000, 0x0b)
+	clk.MCycle(1, gb, audio, &fs)
+	gb.WriteCartridge(0x4000, 0x03)
+	clk.MCycle(1, gb, audio, &fs)
+	if len(events) != 2 || !events[0] || events[1] {
+		t.Fatalf("want rumble on then off, have %v", events)
+	}
+}
+
+func TestMBC2(t *testing.T) {
+	// MBC2+BATTERY, 256 KiB ROM
+	gb, _ := newCartridgeGameboy(0x06, 0x03, 0x00)
+	cart := &gb.Cartridge
+
+	// Address bit 8 clear: RAM enable, anywhere in 0x0000-0x3fff
+	gb.WriteCartridge(0x3e00, 0x0a)
+	if !cart.ExtRAMEnabled || mappedROMBank(gb) != 1 {
+		t.Fatalf("want RAM enabled and ROM bank unchanged")
+	}
+	gb.WriteCartridge(0x0000, 0x00)
+	if cart.ExtRAMEnabled {
+		t.Fatalf("want RAM disabled")
+	}
+
+	// Address bit 8 set: ROM bank, using the low 4 bits
+	for _, tc := range []struct {
+		addr model.Addr
+		v    model.Data8
+		want int
+	}{
+		{addr: 0x0100, v: 0x05, want: 5},
+		{addr: 0x3fff, v: 0xfc, want: 12},
+		{addr: 0x2100, v: 0x00, want: 1},
+		{addr: 0x2100, v: 0x10, want: 1},
+	} {
+		gb.WriteCartridge(tc.addr, tc.v)
+		if have := mappedROMBank(gb); have != tc.want {
+			t.Fatalf("wrote %s to %s: want bank %d have %d", tc.v.Hex(), tc.addr.Hex(), tc.want, have)
+		}
+	}
+	if cart.ExtRAMEnabled {
+		t.Fatalf("want ROM bank writes to leave RAM disabled")
+	}
+
+	// Writes to 0x4000-0x7fff do nothing
+	gb.WriteCartridge(0x4100, 0x03)
+	gb.WriteCartridge(0x4000, 0x0a)
+	if mappedROMBank(gb) != 1 || cart.ExtRAMEnabled {
+		t.Fatalf("want no effect from writes above 0x3fff")
+	}
+}
+
+func TestMBC2RAM(t *testing.T) {
+	gb, _ := newCartridgeGameboy(0x06, 0x03, 0x00)
+	gb.WriteCartridgeRAM(0xa000, 0x05)
+	if have := gb.ReadCartridgeRAM(0xa000); have != 0xff {
+		t.Fatalf("want $FF with RAM disabled, have %s", have.Hex())
+	}
+
+	gb.WriteCartridge(0x0000, 0x0a)
+	gb.WriteCartridgeRAM(0xa000, 0xa5)
+	gb.WriteCartridgeRAM(0xa1ff, 0x3c)
+	if have := gb.Cartridge.RAM[0][0]; have != 0x05 {
+		t.Fatalf("want only the low nibble stored, have %s", have.Hex())
+	}
+	// The 512 cells repeat through 0xa000-0xbfff
+	for base := model.Addr(0xa000); base < 0xc000; base += 0x200 {
+		if have := gb.ReadCartridgeRAM(base); have != 0xf5 {
+			t.Fatalf("%s: want $F5, have %s", base.Hex(), have.Hex())
+		}
+		if have := gb.ReadCartridgeRAM(base + 0x1ff); have != 0xfc {
+			t.Fatalf("%s: want $FC, have %s", (base + 0x1ff).Hex(), have.Hex())
+		}
+	}
+	gb.WriteCartridgeRAM(0xbe00, 0x07)
+	if have := gb.ReadCartridgeRAM(0xa000); have != 0xf7 {
+		t.Fatalf("want echoed write, have %s", have.Hex())
+	}
+}
@@ -1,7 +1,10 @@
 package model
 
 import (
+	"bufio"
 	"fmt"
+	"slices"
+	"sort"
 	"sync/atomic"
 	"time"
 )
@@ -16,18 +19,33 @@ type ClockRT struct {
 	stop            chan struct{}
 	jobs            chan func()
 	uiDevices       []func()
+	rumbleListeners []func(on bool)
+	rumbleOn        bool
+	frameListeners  []func(frame uint, vp *ViewPort)
+	inputListeners  []func(ev InputEvent)
+	breakListeners  []func()
+	fetchListeners  []func(gb *Gameboy)
+	trace           *bufio.Writer
+	inputs          []InputEvent
+	serialPeer      SerialPeer
+	frameCount      uint
+	// Re-executing for reverse debugging, see Snapshots.replay
+	replaying       bool
 	Onpanic         func(gb *Gameboy)
 	PauseAfterCycle atomic.Int32
+	// Pause after the next instruction fetch, i.e. at the next instruction boundary
+	PauseAfterFetch atomic.Bool
 	Running         atomic.Bool
 }
 
 func NewClock() *ClockRT {
 	return &ClockRT{
-		resume:  make(chan struct{}),
-		pause:   make(chan chan bool),
-		stop:    make(chan struct{}),
-		jobs:    make(chan func()),
-		Onpanic: func(gb *Gameboy) {},
+		resume:     make(chan struct{}),
+		pause:      make(chan chan bool),
+		stop:       make(chan struct{}),
+		jobs:       make(chan func()),
+		Onpanic:    func(gb *Gameboy) {},
+		serialPeer: SerialDisconnected{},
 	}
 }
 
@@ -51,8 +69,75 @@ func (clockRT *ClockRT) AttachUIDevice(dev func()) {
 	clockRT.uiDevices = append(clockRT.uiDevices, dev)
 }
 
+// Subscribe to changes in the cartridge's rumble motor.
+// The listener is called from the clock's goroutine, so it should not block.
+func (clockRT *ClockRT) AttachRumbleListener(f func(on bool)) {
+	clockRT.rumbleListeners = append(clockRT.rumbleListeners, f)
+}
+
+// Connect the link cable to a peer.
+// Must be called before the clock is started, or through Sync.
+func (clockRT *ClockRT) SetSerialPeer(peer SerialPeer) {
+	clockRT.serialPeer = peer
+}
+
+// Subscribe to completed frames. The listener is called from the clock's goroutine at the start of VBlank,
+// with the number of frames completed so far. The viewport must not be retained after the listener returns.
+func (clockRT *ClockRT) AttachFrameListener(f func(frame uint, vp *ViewPort)) {
+	clockRT.frameListeners = append(clockRT.frameListeners, f)
+}
+
+// Subscribe to joypad input. The listener is called from the clock's goroutine when the input is applied,
+// with the cycle it was applied at.
+func (clockRT *ClockRT) AttachInputListener(f func(ev InputEvent)) {
+	clockRT.inputListeners = append(clockRT.inputListeners, f)
+}
+
+// Subscribe to the clock pausing because of PauseAfterCycle, e.g. at a breakpoint.
+// The listener is called from the clock's goroutine right before it pauses, so it should not block.
+func (clockRT *ClockRT) AttachBreakListener(f func()) {
+	clockRT.breakListeners = append(clockRT.breakListeners, f)
+}
+
+// Subscribe to instruction boundaries. The listener is called from the clock's goroutine when a fetched instruction
+// starts executing, with PC at the instruction. Fetches discarded by an interrupt dispatch are skipped.
+func (clockRT *ClockRT) AttachFetchListener(f func(gb *Gameboy)) {
+	clockRT.fetchListeners = append(clockRT.fetchListeners, f)
+}
+
+// Schedules joypad input for the start of the M-cycle at ev.Cycle, or the next M-cycle if that has passed.
+// Must be called from the clock's goroutine, or when the clock isn't running.
+func (clockRT *ClockRT) ScheduleInput(ev InputEvent) {
+	i := sort.Search(len(clockRT.inputs), func(i int) bool {
+		return clockRT.inputs[i].Cycle > ev.Cycle
+	})
+	clockRT.inputs = slices.Insert(clockRT.inputs, i, ev)
+}
+
+func (clockRT *ClockRT) applyInputs(gb *Gameboy) {
+	for len(clockRT.inputs) > 0 && clockRT.inputs[0].Cycle <= clockRT.Cycle {
+		ev := clockRT.inputs[0]
+		clockRT.inputs = clockRT.inputs[1:]
+		ev.Cycle = clockRT.Cycle
+		gb.Joypad.Apply(gb, ev.State)
+		for _, f := range clockRT.inputListeners {
+			f(ev)
+		}
+	}
+}
+
+func (clockRT *ClockRT) setRumble(on bool) {
+	clockRT.rumbleOn = on
+	for _, f := range clockRT.rumbleListeners {
+		f(on)
+	}
+}
+
 func (clockRT *ClockRT) wait() bool {
 	clockRT.Running.Store(false)
+	if err := clockRT.flushTrace(); err != nil {
+		fmt.Printf("trace: %v\n", err)
+	}
 	for {
 		resumed := false
 		select {
@@ -151,6 +236,17 @@ func (clockRT *ClockRT) Start() {
 	clockRT.resume <- struct{}{}
 }
 
+// Start the clock if it is paused, without blocking if it isn't.
+// Returns whether the clock was started.
+func (clockRT *ClockRT) TryStart() bool {
+	select {
+	case clockRT.resume <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
 // Pause the clock
 // When this function returns, the clock has paused.
 // Returns the previous run state of the clock
@@ -180,6 +276,9 @@ func (clockRT *ClockRT) MCycle(
 
 		// Breakpoints will stop here, right before executing next M-cycle
 		if clockRT.PauseAfterCycle.Load() > 0 {
+			for _, f := range clockRT.breakListeners {
+				f()
+			}
 			exit := clockRT.wait()
 			if exit {
 				return
@@ -187,43 +286,64 @@ func (clockRT *ClockRT) MCycle(
 			clockRT.PauseAfterCycle.Add(-1)
 		}
 
-		audio.Clock(&gb.APU)
+		if len(clockRT.inputs) > 0 {
+			clockRT.applyInputs(gb)
+		}
 
-		gb.applyPendingIME()
+		audio.Clock(&gb.APU)
 
 		// Clock the CPU. This is the only place where the enabled-state of APU/PPU can change.
 		gb.CPU.fsm(clockRT, gb)
+		if gb.Cartridge.RumbleOn != clockRT.rumbleOn {
+			clockRT.setRumble(gb.Cartridge.RumbleOn)
+		}
 
 		m := clockRT.Cycle >> 2
 		clockRT.Cycle += 4
 
-		// Clock the peripherals.
-		// 99.99% of the time, both PPU and APU are on, so we clock everything
-		if gb.PPU.RegLCDC&gb.APU.MasterCtl&Bit7 != 0 {
-			// T0
-			gb.tickDIV()
-			gb.APU.Wave.clock(gb.Mem)
-			if m&0x1 == 0 {
-				gb.APU.Pulse1.clock()
-				gb.APU.Pulse2.clock()
-			}
-			if clockRT.Cycle&0xf == 0 {
-				gb.APU.Noise.clock()
+		if gb.Cartridge.MBCFeatures.RTC {
+			gb.Cartridge.RTC.clock()
+		}
+		gb.clockSerial(clockRT.serialPeer)
+
+		// In STOP mode the system clock is stopped, so DIV, the timer, the APU and the PPU stand still
+		if !gb.CPU.Stopped {
+			// Clock the peripherals.
+			// 99.99% of the time, both PPU and APU are on, so we clock everything
+			if gb.PPU.RegLCDC&gb.APU.MasterCtl&Bit7 != 0 {
+				// T0
+				gb.tickDIV()
+				gb.APU.Wave.clock(gb.Mem)
+				if m&0x1 == 0 {
+					gb.APU.Pulse1.clock()
+					gb.APU.Pulse2.clock()
+				}
+				if clockRT.Cycle&0xf == 0 {
+					gb.APU.Noise.clock()
+				}
+				gb.PPU.fsm(gb, clockRT, fs)
+
+				// T1
+				gb.tickDIV()
+
+				// T2
+				gb.PPU.fsm(gb, clockRT, fs)
+				gb.tickDIV()
+
+				// T3
+				gb.tickDIV()
+			} else {
+				clockRT.mCycleSlowPath(m, gb, fs)
 			}
-			gb.PPU.fsm(gb, clockRT, fs)
-
-			// T1
-			gb.tickDIV()
-
-			// T2
-			gb.PPU.fsm(gb, clockRT, fs)
-			gb.tickDIV()
+		}
 
-			// T3
-			gb.tickDIV()
-		} else {
-			clockRT.mCycleSlowPath(m, gb, fs)
+		// The frame count only goes down when the PPU is reset, that's not a new frame
+		if gb.PPU.FrameCount > clockRT.frameCount {
+			for _, f := range clockRT.frameListeners {
+				f(gb.PPU.FrameCount, &gb.PPU.FBViewport)
+			}
 		}
+		clockRT.frameCount = gb.PPU.FrameCount
 	}
 }
 
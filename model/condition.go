@@ -0,0 +1,288 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Breakpoint conditions are expressions over registers, flags and memory, e.g. "A == $3F && [$C0A0] > 2".
+//
+//	Registers:  A B C D E F H L, AF BC DE HL SP PC
+//	Flags:      ZF NF HF CF (0 or 1)
+//	Memory:     [addr] reads a byte without side effects
+//	Numbers:    decimal, $hex, 0xhex or %binary
+//	Operators:  || && == != < <= > >= | ^ & + - ! (C precedence except | ^ & are equal), and parentheses
+//
+// The expression is true if it evaluates to anything but 0.
+type condition []condOp
+
+// One step of the expression in postfix order
+type condOp struct {
+	Kind  condOpKind
+	Value int64
+	Name  string
+}
+
+type condOpKind uint8
+
+const (
+	condPush condOpKind = iota
+	condLoad
+	condRead
+	condNot
+	condNeg
+	condBinary
+)
+
+var condOperands = map[string]func(gb *Gameboy) int64{
+	"A":  func(gb *Gameboy) int64 { return int64(gb.CPU.Regs.A) },
+	"B":  func(gb *Gameboy) int64 { return int64(gb.CPU.Regs.B) },
+	"C":  func(gb *Gameboy) int64 { return int64(gb.CPU.Regs.C) },
+	"D":  func(gb *Gameboy) int64 { return int64(gb.CPU.Regs.D) },
+	"E":  func(gb *Gameboy) int64 { return int64(gb.CPU.Regs.E) },
+	"F":  func(gb *Gameboy) int64 { return int64(gb.CPU.Regs.F) },
+	"H":  func(gb *Gameboy) int64 { return int64(gb.CPU.Regs.H) },
+	"L":  func(gb *Gameboy) int64 { return int64(gb.CPU.Regs.L) },
+	"AF": func(gb *Gameboy) int64 { return int64(join16(gb.CPU.Regs.A, gb.CPU.Regs.F)) },
+	"BC": func(gb *Gameboy) int64 { return int64(join16(gb.CPU.Regs.B, gb.CPU.Regs.C)) },
+	"DE": func(gb *Gameboy) int64 { return int64(join16(gb.CPU.Regs.D, gb.CPU.Regs.E)) },
+	"HL": func(gb *Gameboy) int64 { return int64(join16(gb.CPU.Regs.H, gb.CPU.Regs.L)) },
+	"SP": func(gb *Gameboy) int64 { return int64(gb.CPU.Regs.SP) },
+	"PC": func(gb *Gameboy) int64 { return int64(gb.CPU.Regs.PC) },
+	"ZF": func(gb *Gameboy) int64 { return condFlag(gb, Bit7) },
+	"NF": func(gb *Gameboy) int64 { return condFlag(gb, Bit6) },
+	"HF": func(gb *Gameboy) int64 { return condFlag(gb, Bit5) },
+	"CF": func(gb *Gameboy) int64 { return condFlag(gb, Bit4) },
+}
+
+func condFlag(gb *Gameboy, bit Data8) int64 {
+	if gb.CPU.Regs.F&bit != 0 {
+		return 1
+	}
+	return 0
+}
+
+// Operators by precedence, lowest first
+var condPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"|", "^", "&"},
+	{"+", "-"},
+}
+
+func parseCondition(src string) (condition, error) {
+	p := condParser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if err := p.binary(0); err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("condition '%s': unexpected '%s'", src, p.tok)
+	}
+	return p.out, nil
+}
+
+func (c condition) eval(gb *Gameboy) int64 {
+	stack := make([]int64, 0, 8)
+	for _, op := range c {
+		switch op.Kind {
+		case condPush:
+			stack = append(stack, op.Value)
+		case condLoad:
+			stack = append(stack, condOperands[op.Name](gb))
+		case condRead:
+			stack[len(stack)-1] = int64(gb.ProbeAddress(Addr(stack[len(stack)-1])))
+		case condNot:
+			stack[len(stack)-1] = condBool(stack[len(stack)-1] == 0)
+		case condNeg:
+			stack[len(stack)-1] = -stack[len(stack)-1]
+		case condBinary:
+			a, b := stack[len(stack)-2], stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			stack[len(stack)-1] = condApply(op.Name, a, b)
+		}
+	}
+	return stack[0]
+}
+
+func condApply(op string, a, b int64) int64 {
+	switch op {
+	case "||":
+		return condBool(a != 0 || b != 0)
+	case "&&":
+		return condBool(a != 0 && b != 0)
+	case "==":
+		return condBool(a == b)
+	case "!=":
+		return condBool(a != b)
+	case "<":
+		return condBool(a < b)
+	case "<=":
+		return condBool(a <= b)
+	case ">":
+		return condBool(a > b)
+	case ">=":
+		return condBool(a >= b)
+	case "|":
+		return a | b
+	case "^":
+		return a ^ b
+	case "&":
+		return a & b
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	}
+	panicf("unknown operator %s", op)
+	return 0
+}
+
+func condBool(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type condParser struct {
+	src string
+	pos int
+	tok string
+	out condition
+}
+
+func (p *condParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("condition '%s': %s", p.src, fmt.Sprintf(format, args...))
+}
+
+func (p *condParser) next() error {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+	if p.pos == len(p.src) {
+		p.tok = ""
+		return nil
+	}
+	rest := p.src[p.pos:]
+	for _, op := range []string{"||", "&&", "==", "!=", "<=", ">="} {
+		if strings.HasPrefix(rest, op) {
+			p.tok = op
+			p.pos += len(op)
+			return nil
+		}
+	}
+	if strings.ContainsRune("<>|^&+-!()[]", rune(rest[0])) {
+		p.tok = rest[:1]
+		p.pos++
+		return nil
+	}
+	end := 0
+	for end < len(rest) && (isCondWordChar(rest[end]) || (end == 0 && (rest[0] == '$' || rest[0] == '%'))) {
+		end++
+	}
+	if end == 0 {
+		return p.errorf("unexpected '%c'", rest[0])
+	}
+	p.tok = rest[:end]
+	p.pos += end
+	return nil
+}
+
+func isCondWordChar(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func (p *condParser) binary(level int) error {
+	if level == len(condPrecedence) {
+		return p.unary()
+	}
+	if err := p.binary(level + 1); err != nil {
+		return err
+	}
+	for slices.Contains(condPrecedence[level], p.tok) {
+		op := p.tok
+		if err := p.next(); err != nil {
+			return err
+		}
+		if err := p.binary(level + 1); err != nil {
+			return err
+		}
+		p.out = append(p.out, condOp{Kind: condBinary, Name: op})
+		if level == 2 {
+			// Comparisons don't chain
+			break
+		}
+	}
+	return nil
+}
+
+func (p *condParser) unary() error {
+	switch p.tok {
+	case "!", "-":
+		kind := condNot
+		if p.tok == "-" {
+			kind = condNeg
+		}
+		if err := p.next(); err != nil {
+			return err
+		}
+		if err := p.unary(); err != nil {
+			return err
+		}
+		p.out = append(p.out, condOp{Kind: kind})
+		return nil
+	}
+	return p.primary()
+}
+
+func (p *condParser) primary() error {
+	tok := p.tok
+	switch tok {
+	case "":
+		return p.errorf("unexpected end")
+	case "(", "[":
+		closing := map[string]string{"(": ")", "[": "]"}[tok]
+		if err := p.next(); err != nil {
+			return err
+		}
+		if err := p.binary(0); err != nil {
+			return err
+		}
+		if p.tok != closing {
+			return p.errorf("expected '%s'", closing)
+		}
+		if tok == "[" {
+			p.out = append(p.out, condOp{Kind: condRead})
+		}
+		return p.next()
+	}
+	if _, ok := condOperands[strings.ToUpper(tok)]; ok {
+		p.out = append(p.out, condOp{Kind: condLoad, Name: strings.ToUpper(tok)})
+		return p.next()
+	}
+	v, err := ParseNumber(tok)
+	if err != nil {
+		return p.errorf("unknown operand '%s'", tok)
+	}
+	p.out = append(p.out, condOp{Kind: condPush, Value: v})
+	return p.next()
+}
+
+// Parses a decimal, $hex, 0xhex or %binary number
+func ParseNumber(s string) (int64, error) {
+	switch {
+	case strings.HasPrefix(s, "$"):
+		return strconv.ParseInt(s[1:], 16, 64)
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		return strconv.ParseInt(s[2:], 16, 64)
+	case strings.HasPrefix(s, "%"):
+		return strconv.ParseInt(s[1:], 2, 64)
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
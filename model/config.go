@@ -19,6 +19,13 @@ type ConfigDebug struct {
 	RewindSize            int
 	PanicOnStackUnderflow bool
 	Disassembler          ConfigDisassembler
+
+	// File to write a Gameboy Doctor trace of every executed instruction to, or empty to disable
+	Trace string
+
+	// Make LY read as $90, like in the emulators that made the Gameboy Doctor reference logs.
+	// Only for comparing traces, since most games wait for LY to change.
+	StubLY bool
 }
 
 type ConfigDisassembler struct {
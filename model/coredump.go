@@ -244,12 +244,15 @@ func (cpu *CPU) Dump(gb *Gameboy) {
 	fmt.Printf("Last executed instructions:\n")
 	gb.PrintRewindBuffer(f, false)
 	fmt.Fprintf(f, "--------\n")
+	fmt.Fprintf(f, "Call stack:\n")
+	gb.PrintCallStack(f)
+	fmt.Fprintf(f, "--------\n")
 }
 
 func (gb *Gameboy) PrintRewindBuffer(f io.Writer, reverse bool) {
 	rw := &gb.CPU.Rewind
 	curr := rw.Curr()
-	currTxt := fmt.Sprintf("Current: [PC=%s] %s (%d)\n", curr.Instruction.Address.Hex(), curr.Instruction.Asm(), gb.CPU.UOpCycle)
+	currTxt := fmt.Sprintf("Current: [PC=%s] %s (%d)\n", curr.Instruction.Address.Hex(), curr.Instruction.Asm(gb), gb.CPU.UOpCycle)
 
 	if reverse {
 		fmt.Fprint(f, currTxt)
@@ -279,9 +282,9 @@ func (gb *Gameboy) printRewindEntry(f io.Writer, i int) {
 	if entry.Instruction.NopCount > 0 {
 		extra += fmt.Sprintf(" (x%d)", entry.Instruction.NopCount+1)
 	}
-	fmt.Fprintf(f, "[PC=%s] %s%s\n", entry.Instruction.Address.Hex(), entry.Instruction.Asm(), extra)
+	fmt.Fprintf(f, "[PC=%s] %s%s\n", entry.Instruction.Address.Hex(), entry.Instruction.Asm(gb), extra)
 }
 
 func (cd *CoreDump) PrintDisassembly(f io.Writer) {
-	cd.Disassembly.Print(f)
+	cd.Disassembly.Print(f, nil)
 }
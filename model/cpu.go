@@ -7,6 +7,17 @@ type CPU struct {
 	UOpCycle         int
 	Rewind           Rewind
 	LastBranchResult int
+
+	// Hung after executing an undefined opcode, only a reset recovers
+	Locked bool
+	// PC fails to increment on the next fetch, see halt
+	HaltBug bool
+	// In STOP mode until a joypad line goes low. DIV, the timer, the APU and the LCD are stopped too.
+	Stopped bool
+	// Address of the opcode in IR
+	FetchAddr Addr
+	// The opcode in IR hasn't started executing yet. It is discarded if an interrupt is dispatched instead.
+	FetchPending bool
 }
 
 func (cpu *CPU) CurrInstruction() (DisInstruction, int) {
@@ -67,16 +78,46 @@ func (cpu *CPU) IncPC() {
 }
 
 func (cpu *CPU) fsm(clk *ClockRT, gb *Gameboy) {
+	if cpu.Locked {
+		return
+	}
+	if cpu.Stopped {
+		if gb.joypadLow() {
+			cpu.Stopped = false
+		}
+		return
+	}
 	if cpu.Halted {
+		// Leaving HALT takes an M-cycle once an interrupt is requested, whether or not it will be serviced
+		if gb.requestedInterrupt() != IntSourceNone {
+			cpu.Halted = false
+		}
 		return
 	}
+	if cpu.UOpCycle == 1 && gb.Interrupts.PendingInterrupt == 0 {
+		gb.interruptCheck()
+	}
 	var handler UOpHandler
-	if gb.Interrupts.PendingInterrupt != 0 {
+	irq := gb.Interrupts.PendingInterrupt != 0
+	if cpu.FetchPending {
+		cpu.FetchPending = false
+		if !irq {
+			clk.onExecute(gb)
+		}
+	}
+	if irq {
 		handler = IRQHandler[cpu.UOpCycle-1]
 	} else {
 		handler = Handlers[cpu.Regs.IR][cpu.UOpCycle-1]
 	}
-	if done := handler(gb); done {
+	gb.Debug.Access = BusAccess{}
+	done := handler(gb)
+	gb.Debug.checkAccess(gb, clk)
+	if done {
+		if !irq {
+			gb.applyPendingIME()
+		}
+		gb.Debug.trackCalls(gb, irq)
 		gb.WriteAddress(cpu.Regs.PC)
 		gb.instructionFetch(clk)
 		cpu.UOpCycle = 0
@@ -91,9 +132,14 @@ func (gb *Gameboy) instructionFetch(clk *ClockRT) {
 	cpu.Regs.SetWZ(0)
 
 	// Read next instruction opcode
-	rawOp := gb.Mem[cpu.Regs.PC]
+	rawOp := gb.ProbeAddress(cpu.Regs.PC)
 	cpu.Regs.IR = Opcode(rawOp)
+	cpu.FetchAddr = cpu.Regs.PC
+	cpu.FetchPending = true
 	gb.Debug.SetIR(gb, cpu.Regs.IR, clk)
+	if clk.PauseAfterFetch.Load() && clk.PauseAfterFetch.Swap(false) {
+		clk.PauseAfterCycle.Add(1)
+	}
 
 	di := DisInstruction{
 		Address: cpu.Regs.PC,
@@ -106,22 +152,28 @@ func (gb *Gameboy) instructionFetch(clk *ClockRT) {
 		panicf("no size set for %v", cpu.Regs.IR)
 	}
 	for i := Size16(1); i < size; i++ {
-		di.Raw[i] = gb.Mem[cpu.Regs.PC+Addr(i)]
+		di.Raw[i] = gb.ProbeAddress(cpu.Regs.PC + Addr(i))
 	}
 
-	// Update rewind buffer
-	curr := cpu.Rewind.Curr()
-	curr.BranchResult = cpu.LastBranchResult
-	if curr.Instruction.Opcode == OpcodeNop && di.Opcode == OpcodeNop {
-		curr.Instruction.NopCount++
-	} else {
-		cpu.LastBranchResult = 0
-		entry := cpu.Rewind.Push()
-		entry.Instruction = di
+	// Update rewind buffer. Re-execution for reverse debugging has already been logged.
+	if !clk.replaying {
+		curr := cpu.Rewind.Curr()
+		curr.BranchResult = cpu.LastBranchResult
+		if curr.Instruction.Opcode == OpcodeNop && di.Opcode == OpcodeNop {
+			curr.Instruction.NopCount++
+		} else {
+			entry := cpu.Rewind.Push()
+			entry.Instruction = di
+		}
 	}
+	cpu.LastBranchResult = 0
 
 	// Set PC
 	gb.Debug.SetPC(gb, cpu.Regs.PC, clk)
 
-	cpu.IncPC()
+	if cpu.HaltBug {
+		cpu.HaltBug = false
+	} else {
+		cpu.IncPC()
+	}
 }
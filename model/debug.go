@@ -9,6 +9,12 @@ type Debug struct {
 	Disassembler
 	Debugger
 	Warnings map[string]UserMessage
+
+	// Labels from the ROM's .sym file, if any
+	Symbols Symbols
+
+	// LY reads as $90, see ConfigDebug.StubLY
+	StubLY bool
 }
 
 type UserMessage struct {
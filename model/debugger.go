@@ -2,22 +2,357 @@ package model
 
 import (
 	"fmt"
+	"io"
+	"slices"
+	"strings"
 )
 
+//go:generate go-enum --marshal --flag --values --nocomments
+
 type Debugger struct {
-	BreakX  int64
-	BreakY  int64
-	BreakPC int64
-	BreakIR int64
-	CurrY   Data8
+	Breakpoints      []Breakpoint
+	NextBreakpointID int
+	CurrY            Data8
+
+	// Break when a Mooneye test ROM reports its result
+	BreakMooneye bool
+	Mooneye      MooneyeResult
+
+	// Number of instructions fetched
+	Fetches uint
+
+	// CPU bus access in the current M-cycle, checked against watchpoints when the M-cycle is done
+	Access BusAccess
+
+	// Subroutine calls and interrupts that haven't returned yet, outermost first
+	Calls []CallFrame
+
+	// Append every CPU bus access to BusLog, e.g. to verify bus timing in tests
+	RecordBus bool
+	BusLog    []BusAccess
+}
+
+// Read, Write and Change are watchpoints on CPU accesses. Change only triggers on writes that change the value.
+// Opcode fetches are not reads, but immediate operands are.
+// ENUM(PC, IR, PPU, Read, Write, Change)
+type BreakpointKind uint8
+
+type Breakpoint struct {
+	ID   int
+	Kind BreakpointKind
+
+	// Address for PC breakpoints, opcode for IR breakpoints, X for PPU breakpoints, first address for watchpoints
+	Location int64
+	// Line for PPU breakpoints
+	Y int64
+	// Last address for watchpoints
+	End int64
+	// Label the location was given as, if any
+	Symbol string
+	// Only break with Bank mapped in, for labels in switchable ROM or cartridge RAM
+	Banked bool
+	Bank   uint16
+
+	Enabled bool
+
+	// Number of times the breakpoint was reached with the condition true
+	Hits uint
+	// Number of hits to let through before breaking
+	Ignore uint
+
+	// Optional, see condition.go for the syntax
+	Condition string
+	Compiled  condition
+}
+
+type BusAccess struct {
+	Pending bool
+	Write   bool
+	Addr    Addr
+	// Value before the access, same as Value for reads
+	Old   Data8
+	Value Data8
 }
 
+// Mooneye test ROMs report their result by loading a register signature and executing LD B,B
+// ENUM(None, Passed, Failed)
+type MooneyeResult uint8
+
+var (
+	mooneyePassed = [6]Data8{3, 5, 8, 13, 21, 34}
+	mooneyeFailed = [6]Data8{0x42, 0x42, 0x42, 0x42, 0x42, 0x42}
+)
+
 func NewDebugger() Debugger {
 	return Debugger{
-		BreakX:  -1,
-		BreakY:  -1,
-		BreakPC: -1,
-		BreakIR: -1,
+		NextBreakpointID: 1,
+	}
+}
+
+// Adds the breakpoint, returning its ID
+func (dbg *Debugger) AddBreakpoint(bp Breakpoint) (int, error) {
+	if bp.Condition != "" {
+		compiled, err := parseCondition(bp.Condition)
+		if err != nil {
+			return 0, err
+		}
+		bp.Compiled = compiled
+	}
+	bp.ID = dbg.NextBreakpointID
+	dbg.NextBreakpointID++
+	dbg.Breakpoints = append(dbg.Breakpoints, bp)
+	return bp.ID, nil
+}
+
+func (dbg *Debugger) RemoveBreakpoint(id int) error {
+	for i := range dbg.Breakpoints {
+		if dbg.Breakpoints[i].ID == id {
+			dbg.Breakpoints = slices.Delete(dbg.Breakpoints, i, i+1)
+			return nil
+		}
+	}
+	return fmt.Errorf("no breakpoint %d", id)
+}
+
+func (dbg *Debugger) EnableBreakpoint(id int, enabled bool) error {
+	for i := range dbg.Breakpoints {
+		if dbg.Breakpoints[i].ID == id {
+			dbg.Breakpoints[i].Enabled = enabled
+			return nil
+		}
+	}
+	return fmt.Errorf("no breakpoint %d", id)
+}
+
+func (dbg *Debugger) PrintBreakpoints(w io.Writer) {
+	if len(dbg.Breakpoints) == 0 {
+		fmt.Fprintf(w, "No breakpoints\n")
+	}
+	for _, bp := range dbg.Breakpoints {
+		enabled := "on "
+		if !bp.Enabled {
+			enabled = "off"
+		}
+		fmt.Fprintf(w, "%3d %s %-12s hits=%d", bp.ID, enabled, bp.Where(), bp.Hits)
+		if bp.Ignore > 0 {
+			fmt.Fprintf(w, " ignore=%d", bp.Ignore)
+		}
+		if bp.Condition != "" {
+			fmt.Fprintf(w, " if %s", bp.Condition)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+// Parses a breakpoint kind ("pc", "ir", "ppu", "read", "write" or "change") and location
+// ("$0150", "$3E", "x,y", or "$C000-$C0FF" or "LCDC" for watchpoints).
+// PC breakpoints and watchpoints also take labels from syms, which may be nil.
+// The breakpoint is enabled.
+func ParseBreakpoint(kind, location string, syms *Symbols) (Breakpoint, error) {
+	bp := Breakpoint{Enabled: true}
+	i := slices.IndexFunc(BreakpointKindValues(), func(k BreakpointKind) bool {
+		return strings.EqualFold(k.String(), kind)
+	})
+	if i < 0 {
+		return bp, fmt.Errorf("%s is not a valid breakpoint kind", kind)
+	}
+	k := BreakpointKindValues()[i]
+	bp.Kind = k
+	var err error
+	if k == BreakpointKindPPU {
+		x, y, ok := strings.Cut(location, ",")
+		if !ok {
+			return bp, fmt.Errorf("PPU breakpoint location must be 'x,y'")
+		}
+		if bp.Location, err = ParseNumber(strings.TrimSpace(x)); err != nil {
+			return bp, fmt.Errorf("invalid X '%s'", x)
+		}
+		if bp.Y, err = ParseNumber(strings.TrimSpace(y)); err != nil {
+			return bp, fmt.Errorf("invalid Y '%s'", y)
+		}
+		return bp, nil
+	}
+	if k.IsWatchpoint() {
+		first, last, isRange := strings.Cut(location, "-")
+		if bp.Location, err = parseWatchAddr(first); err != nil {
+			if !bp.setSymbol(first, syms) {
+				return bp, err
+			}
+		}
+		bp.End = bp.Location
+		if isRange {
+			if bp.End, err = parseWatchAddr(last); err != nil {
+				sa, ok := lookupSymbol(last, syms)
+				if !ok {
+					return bp, err
+				}
+				bp.End = int64(sa.Addr)
+			}
+		}
+		if bp.End < bp.Location {
+			return bp, fmt.Errorf("empty range '%s'", location)
+		}
+		return bp, nil
+	}
+	if bp.Location, err = ParseNumber(location); err != nil {
+		if k != BreakpointKindPC || !bp.setSymbol(location, syms) {
+			return bp, fmt.Errorf("invalid location '%s'", location)
+		}
+	}
+	return bp, nil
+}
+
+func lookupSymbol(name string, syms *Symbols) (SymbolAddr, bool) {
+	if syms == nil {
+		return SymbolAddr{}, false
+	}
+	return syms.Lookup(strings.TrimSpace(name))
+}
+
+// Sets the location to the label's address, returns false if there is no such label
+func (bp *Breakpoint) setSymbol(name string, syms *Symbols) bool {
+	sa, ok := lookupSymbol(name, syms)
+	if !ok {
+		return false
+	}
+	bp.Symbol = strings.TrimSpace(name)
+	bp.Location = int64(sa.Addr)
+	bp.Bank = sa.Bank
+	bp.Banked = (sa.Addr > AddrCartridgeBank0End && sa.Addr <= AddrCartridgeBankNEnd) ||
+		(sa.Addr >= AddrCartridgeRAMBegin && sa.Addr <= AddrCartridgeRAMEnd)
+	return true
+}
+
+// Whether the breakpoint's bank is mapped in at addr
+func (bp *Breakpoint) inBank(gb *Gameboy, addr Addr) bool {
+	return !bp.Banked || gb.bankAt(addr) == bp.Bank
+}
+
+// Address or register name, e.g. "$C0A0" or "NR52"
+func parseWatchAddr(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if addr, err := ParseAddr(strings.ToUpper(s)); err == nil {
+		return int64(addr), nil
+	}
+	v, err := ParseNumber(s)
+	if err != nil || v < 0 || v > 0xffff {
+		return 0, fmt.Errorf("invalid address '%s'", s)
+	}
+	return v, nil
+}
+
+func (k BreakpointKind) IsWatchpoint() bool {
+	return k == BreakpointKindRead || k == BreakpointKindWrite || k == BreakpointKindChange
+}
+
+// Kind and location, e.g. "PC $0150" or "PC EntryPoint 0150"
+func (bp *Breakpoint) Where() string {
+	if bp.Symbol != "" && (!bp.Kind.IsWatchpoint() || bp.End == bp.Location) {
+		return fmt.Sprintf("%s %s %s", bp.Kind, bp.Symbol, Addr(bp.Location).Hex())
+	}
+	if bp.Kind.IsWatchpoint() {
+		if bp.End == bp.Location {
+			return fmt.Sprintf("%s %s", bp.Kind, Addr(bp.Location).Hex())
+		}
+		return fmt.Sprintf("%s %s-%s", bp.Kind, Addr(bp.Location).Hex(), Addr(bp.End).Hex())
+	}
+	switch bp.Kind {
+	case BreakpointKindPC:
+		return fmt.Sprintf("PC %s", Addr(bp.Location).Hex())
+	case BreakpointKindIR:
+		return fmt.Sprintf("IR %s", Data8(bp.Location).Hex())
+	case BreakpointKindPPU:
+		return fmt.Sprintf("PPU %d,%d", bp.Location, bp.Y)
+	}
+	return bp.Kind.String()
+}
+
+// Called when the breakpoint's location is reached
+func (dbg *Debugger) check(gb *Gameboy, bp *Breakpoint, clk *ClockRT) {
+	if dbg.hit(gb, bp, clk) {
+		dbg.Break(clk)
+		if !clk.replaying {
+			fmt.Printf("Breakpoint %d (%s)\n", bp.ID, bp.Where())
+		}
+	}
+}
+
+// Evaluates the condition and ignore count, returns whether to break.
+// Re-execution for reverse debugging doesn't count hits, and breaks whenever the condition is true.
+func (dbg *Debugger) hit(gb *Gameboy, bp *Breakpoint, clk *ClockRT) bool {
+	if bp.Compiled != nil && bp.Compiled.eval(gb) == 0 {
+		return false
+	}
+	if clk.replaying {
+		return true
+	}
+	bp.Hits++
+	return bp.Hits > bp.Ignore
+}
+
+// Called by the bus on CPU reads and writes
+func (dbg *Debugger) busAccess(addr Addr, old, v Data8, write bool) {
+	if dbg == nil {
+		return
+	}
+	acc := BusAccess{Write: write, Addr: addr, Old: old, Value: v}
+	if dbg.RecordBus {
+		// A write latches the address first, which looks like a read
+		if n := len(dbg.BusLog); write && n > 0 && !dbg.BusLog[n-1].Write && dbg.BusLog[n-1].Addr == addr {
+			dbg.BusLog[n-1] = acc
+		} else {
+			dbg.BusLog = append(dbg.BusLog, acc)
+		}
+	}
+	if len(dbg.Breakpoints) == 0 {
+		return
+	}
+	acc.Pending = true
+	dbg.Access = acc
+}
+
+// Called after each CPU M-cycle. A write also latches the address, so the access is only known to be a read when the M-cycle is done.
+func (dbg *Debugger) checkAccess(gb *Gameboy, clk *ClockRT) {
+	if dbg == nil || !dbg.Access.Pending {
+		return
+	}
+	acc := dbg.Access
+	dbg.Access = BusAccess{}
+	for i := range dbg.Breakpoints {
+		bp := &dbg.Breakpoints[i]
+		if !bp.Enabled || int64(acc.Addr) < bp.Location || int64(acc.Addr) > bp.End || !bp.inBank(gb, acc.Addr) {
+			continue
+		}
+		switch bp.Kind {
+		case BreakpointKindRead:
+			if acc.Write {
+				continue
+			}
+		case BreakpointKindWrite:
+			if !acc.Write {
+				continue
+			}
+		case BreakpointKindChange:
+			if !acc.Write || acc.Old == acc.Value {
+				continue
+			}
+		default:
+			continue
+		}
+		if !dbg.hit(gb, bp, clk) {
+			continue
+		}
+		dbg.Break(clk)
+		if clk.replaying {
+			continue
+		}
+		inst, _ := gb.CPU.CurrInstruction()
+		if acc.Write {
+			fmt.Printf("Watchpoint %d (%s): [%s] %s -> %s", bp.ID, bp.Where(), acc.Addr.Hex(), acc.Old.Hex(), acc.Value.Hex())
+		} else {
+			fmt.Printf("Watchpoint %d (%s): [%s] = %s", bp.ID, bp.Where(), acc.Addr.Hex(), acc.Value.Hex())
+		}
+		fmt.Printf(" by [PC=%s] %s\n", inst.Address.Hex(), inst.Asm(gb))
 	}
 }
 
@@ -35,14 +370,15 @@ func (dbg *Debugger) SetY(y Data8) {
 	dbg.CurrY = y
 }
 
-func (dbg *Debugger) SetX(x Data8, clk *ClockRT) {
+func (dbg *Debugger) SetX(gb *Gameboy, x Data8, clk *ClockRT) {
 	if dbg == nil {
 		return
 	}
-	bx, by := dbg.BreakX, dbg.BreakY
-	if int64(x) == bx && int64(dbg.CurrY) == by {
-		dbg.Break(clk)
-		fmt.Printf("PPU breakpoint\n")
+	for i := range dbg.Breakpoints {
+		bp := &dbg.Breakpoints[i]
+		if bp.Enabled && bp.Kind == BreakpointKindPPU && bp.Location == int64(x) && bp.Y == int64(dbg.CurrY) {
+			dbg.check(gb, bp, clk)
+		}
 	}
 }
 
@@ -50,12 +386,43 @@ func (dbg *Debugger) SetIR(gb *Gameboy, ir Opcode, clk *ClockRT) {
 	if dbg == nil {
 		return
 	}
-	if dbg.BreakIR == int64(ir) {
-		dbg.Break(clk)
-		fmt.Printf("IR breakpoint\n")
+	dbg.Fetches++
+	if ir == OpcodeLDBB {
+		dbg.checkMooneye(gb, clk)
+	}
+	pc := int64(gb.CPU.Regs.PC)
+	for i := range dbg.Breakpoints {
+		bp := &dbg.Breakpoints[i]
+		if !bp.Enabled {
+			continue
+		}
+		switch bp.Kind {
+		case BreakpointKindPC:
+			if bp.Location >= pc && bp.Location < pc+int64(instSize[ir]) && bp.inBank(gb, Addr(bp.Location)) {
+				dbg.check(gb, bp, clk)
+			}
+		case BreakpointKindIR:
+			if bp.Location == int64(ir) {
+				dbg.check(gb, bp, clk)
+			}
+		}
+	}
+}
+
+func (dbg *Debugger) checkMooneye(gb *Gameboy, clk *ClockRT) {
+	regs := &gb.CPU.Regs
+	switch [6]Data8{regs.B, regs.C, regs.D, regs.E, regs.H, regs.L} {
+	case mooneyePassed:
+		dbg.Mooneye = MooneyeResultPassed
+	case mooneyeFailed:
+		dbg.Mooneye = MooneyeResultFailed
+	default:
+		return
 	}
-	if dbg.BreakPC >= int64(gb.CPU.Regs.PC) && dbg.BreakPC < int64(gb.CPU.Regs.PC+Addr(instSize[ir])) {
+	if dbg.BreakMooneye {
 		dbg.Break(clk)
-		fmt.Printf("PC breakpoint\n")
+		if !clk.replaying {
+			fmt.Printf("Mooneye test %s\n", dbg.Mooneye)
+		}
 	}
 }
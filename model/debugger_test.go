@@ -0,0 +1,222 @@
+package model_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jonathangjertsen/toyboy/model"
+)
+
+func TestBreakpointCondition(t *testing.T) {
+	for _, tc := range []struct {
+		cond  string
+		want  bool
+		error bool
+	}{
+		{cond: "", want: true},
+		{cond: "A == $3F", want: true},
+		{cond: "a == 0x3f && [$C0A0] > 2", want: true},
+		{cond: "A == $3F && [$C0A0] > 3", want: false},
+		{cond: "ZF || CF", want: true},
+		{cond: "!ZF", want: false},
+		{cond: "HL - 1 == $C0FF", want: true},
+		{cond: "(A & %1111) == 15", want: true},
+		{cond: "A == ", error: true},
+		{cond: "Q == 1", error: true},
+		{cond: "A == 1 == 1", error: true},
+	} {
+		t.Run(tc.cond, func(t *testing.T) {
+			gb, clk := newDebuggerGameboy()
+			gb.CPU.Regs.A = 0x3f
+			gb.CPU.Regs.F = 0x80
+			gb.CPU.Regs.H, gb.CPU.Regs.L = 0xc1, 0x00
+			gb.Mem[0xc0a0] = 3
+
+			bp, err := model.ParseBreakpoint("ir", "$00", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bp.Condition = tc.cond
+			_, err = gb.Debug.Debugger.AddBreakpoint(bp)
+			if tc.error {
+				if err == nil {
+					t.Fatalf("want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gb.Debug.SetIR(gb, model.OpcodeNop, clk)
+			if have := clk.PauseAfterCycle.Load() > 0; have != tc.want {
+				t.Fatalf("want break=%v have %v", tc.want, have)
+			}
+		})
+	}
+}
+
+func TestBreakpointIgnoreCount(t *testing.T) {
+	gb, clk := newDebuggerGameboy()
+	gb.CPU.Regs.PC = 0x150
+
+	bp, err := model.ParseBreakpoint("pc", "$0150", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bp.Ignore = 2
+	id, err := gb.Debug.Debugger.AddBreakpoint(bp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		gb.Debug.SetIR(gb, model.OpcodeNop, clk)
+		if have, want := clk.PauseAfterCycle.Load() > 0, i == 2; have != want {
+			t.Fatalf("hit %d: want break=%v have %v", i+1, want, have)
+		}
+	}
+	if err := gb.Debug.Debugger.RemoveBreakpoint(id); err != nil {
+		t.Fatal(err)
+	}
+	if len(gb.Debug.Debugger.Breakpoints) != 0 {
+		t.Fatalf("breakpoint not removed")
+	}
+}
+
+func TestWatchpoints(t *testing.T) {
+	gb, clk := newDebuggerGameboy()
+	gb.SkipBootROM()
+	program := []model.Data8{
+		0x3e, 0x12, // LD A, $12
+		0xea, 0xa0, 0xc0, // LD [$C0A0], A
+		0xfa, 0xa0, 0xc0, // LD A, [$C0A0]
+		0xea, 0xa0, 0xc0, // LD [$C0A0], A
+		0xe0, 0x26, // LDH [NR52], A
+	}
+	copy(gb.Mem[0xc000:], program)
+	gb.CPU.Regs.PC = 0xc000
+
+	hits := map[string]uint{
+		"read $C0A0":           1,
+		"write $C09F-$C0A0":    2,
+		"change $C0A0":         1,
+		"write nr52":           1,
+		"read $C000-$C00F":     8, // Immediate operands, but not opcodes
+		"change $C0A0 if A==0": 0,
+	}
+	ids := map[string]int{}
+	for spec := range hits {
+		kind, location, _ := strings.Cut(spec, " ")
+		location, cond, _ := strings.Cut(location, " if ")
+		bp, err := model.ParseBreakpoint(kind, location, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bp.Condition = cond
+		if ids[spec], err = gb.Debug.Debugger.AddBreakpoint(bp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs := model.FrameSync{}
+	for gb.CPU.Regs.PC < 0xc000+model.Addr(len(program)) {
+		clk.MCycle(1, gb, model.AudioSilent{}, &fs)
+		clk.PauseAfterCycle.Store(0)
+	}
+	for _, bp := range gb.Debug.Debugger.Breakpoints {
+		for spec, id := range ids {
+			if id == bp.ID && bp.Hits != hits[spec] {
+				t.Errorf("%s: want %d hits, have %d", spec, hits[spec], bp.Hits)
+			}
+		}
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	gb, clk := newDebuggerGameboy()
+	gb.SkipBootROM()
+	syms, err := model.ParseSymbols(strings.NewReader(`; File generated by rgblink
+00:c100 Start
+00:c108 Sub
+00:c10b Sub.done
+00:c200 wCounter
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gb.Debug.Symbols = syms
+	program := []model.Data8{
+		0xcd, 0x08, 0xc1, // CALL Sub
+		0x18, 0xfe, // JR PC-$02
+		0x00, 0x00, 0x00,
+		0xea, 0x00, 0xc2, // Sub: LD [wCounter], A
+		0xc9, // .done: RET
+	}
+	copy(gb.Mem[0xc100:], program)
+	gb.CPU.Regs.PC = 0xc100
+
+	for _, tc := range []struct {
+		raw  [3]model.Data8
+		want string
+	}{
+		{raw: [3]model.Data8{0xcd, 0x08, 0xc1}, want: "CALL Sub"},
+		{raw: [3]model.Data8{0xea, 0x00, 0xc2}, want: "LD [wCounter], A"},
+		{raw: [3]model.Data8{0xea, 0x01, 0xc2}, want: "LD [$c201], A"},
+		{raw: [3]model.Data8{0x18, 0xfe}, want: "JR PC-$02"},
+		{raw: [3]model.Data8{0x18, 0x06}, want: "JR Sub.done"},
+	} {
+		di := model.DisInstruction{Address: 0xc103, Opcode: model.Opcode(tc.raw[0]), Raw: tc.raw}
+		if have := di.Asm(gb); have != tc.want {
+			t.Errorf("want %q, have %q", tc.want, have)
+		}
+	}
+	if have := gb.LabelOffset(0xc10a); have != "Sub+$02" {
+		t.Errorf("want Sub+$02, have %s", have)
+	}
+
+	for _, location := range []string{"Sub", ".done"} {
+		bp, err := model.ParseBreakpoint("pc", location, &syms)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := gb.Debug.Debugger.AddBreakpoint(bp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := model.ParseBreakpoint("pc", "Nowhere", &syms); err == nil {
+		t.Fatalf("want error for unknown label")
+	}
+
+	fs := model.FrameSync{}
+	var stacks []string
+	for range 40 {
+		clk.MCycle(1, gb, model.AudioSilent{}, &fs)
+		if clk.PauseAfterCycle.Load() > 0 {
+			clk.PauseAfterCycle.Store(0)
+			var buf strings.Builder
+			gb.PrintCallStack(&buf)
+			stacks = append(stacks, buf.String())
+		}
+	}
+	want := []string{
+		"#0 [PC=c108] Sub\n#1 [PC=c103] Start+$03 (call to Sub)\n",
+		"#0 [PC=c10b] Sub.done\n#1 [PC=c103] Start+$03 (call to Sub)\n",
+	}
+	if strings.Join(stacks, "") != strings.Join(want, "") {
+		t.Fatalf("want call stacks %q, have %q", want, stacks)
+	}
+	if len(gb.Debug.Debugger.Calls) != 0 {
+		t.Fatalf("want empty call stack after RET, have %v", gb.Debug.Debugger.Calls)
+	}
+}
+
+func newDebuggerGameboy() (*model.Gameboy, *model.ClockRT) {
+	clk := model.NewClock()
+	gb := &model.Gameboy{}
+	gb.AllocMem()
+	config := model.DefaultConfig
+	config.BootROM.Variant = "None"
+	config.Debug.RewindSize = 16
+	gb.Init(&config, clk)
+	return gb, clk
+}
@@ -51,23 +51,39 @@ func comment(d Data16) string {
 	return ""
 }
 
-func (di *DisInstruction) Asm() string {
+func label(addr Addr, labels Labeler) (string, bool) {
+	if labels == nil {
+		return "", false
+	}
+	return labels.Label(addr)
+}
+
+// Label for the address if there is one, otherwise the address and the register name if it has one
+func operand(nn Data16, labels Labeler) (string, string) {
+	if label, ok := label(Addr(nn), labels); ok {
+		return label, ""
+	}
+	return "$" + nn.Hex(), comment(nn)
+}
+
+// Assembly for the instruction, with addresses replaced by labels if labels is not nil
+func (di *DisInstruction) Asm(labels Labeler) string {
 	str := di.Opcode.String()
 	ln := len(str)
 	switch di.Opcode {
 	default:
 	case OpcodeLDAnn:
-		nn := join16(di.Raw[2], di.Raw[1])
-		return fmt.Sprintf("LD A, [$%s]%s", nn.Hex(), comment(nn))
+		nn, cmt := operand(join16(di.Raw[2], di.Raw[1]), labels)
+		return fmt.Sprintf("LD A, [%s]%s", nn, cmt)
 	case OpcodeLDBCnn, OpcodeLDDEnn, OpcodeLDHLnn, OpcodeLDSPnn:
-		nn := join16(di.Raw[2], di.Raw[1])
-		return fmt.Sprintf("LD %s, [$%s]%s", str[ln-4:ln-2], nn.Hex(), comment(nn))
+		nn, cmt := operand(join16(di.Raw[2], di.Raw[1]), labels)
+		return fmt.Sprintf("LD %s, [%s]%s", str[ln-4:ln-2], nn, cmt)
 	case OpcodeLDnnA:
-		nn := join16(di.Raw[2], di.Raw[1])
-		return fmt.Sprintf("LD [$%s], A%s", nn.Hex(), comment(nn))
+		nn, cmt := operand(join16(di.Raw[2], di.Raw[1]), labels)
+		return fmt.Sprintf("LD [%s], A%s", nn, cmt)
 	case OpcodeLDnnSP:
-		nn := join16(di.Raw[2], di.Raw[1])
-		return fmt.Sprintf("LD [$%s], SP%s", nn.Hex(), comment(nn))
+		nn, cmt := operand(join16(di.Raw[2], di.Raw[1]), labels)
+		return fmt.Sprintf("LD [%s], SP%s", nn, cmt)
 	case OpcodeLDHLAInc:
 		return "LD (HL+), A"
 	case OpcodeLDHLADec:
@@ -139,35 +155,41 @@ func (di *DisInstruction) Asm() string {
 	case OpcodeDECBC, OpcodeDECDE, OpcodeDECHL, OpcodeDECSP:
 		return fmt.Sprintf("DEC %s", str[ln-2:])
 	case OpcodeJPnn, OpcodeCALLnn:
-		nn := join16(di.Raw[2], di.Raw[1])
-		return fmt.Sprintf("%s $%s%s", str[:ln-2], nn.Hex(), comment(nn))
+		nn, cmt := operand(join16(di.Raw[2], di.Raw[1]), labels)
+		return fmt.Sprintf("%s %s%s", str[:ln-2], nn, cmt)
 	case OpcodeJPCnn, OpcodeJPZnn:
-		nn := join16(di.Raw[2], di.Raw[1])
-		return fmt.Sprintf("JP %s, $%s%s", str[ln-3:ln-2], nn.Hex(), comment(nn))
+		nn, cmt := operand(join16(di.Raw[2], di.Raw[1]), labels)
+		return fmt.Sprintf("JP %s, %s%s", str[ln-3:ln-2], nn, cmt)
 	case OpcodeJPNZnn, OpcodeJPNCnn:
-		nn := join16(di.Raw[2], di.Raw[1])
-		return fmt.Sprintf("JP %s, $%s%s", str[ln-4:ln-2], nn.Hex(), comment(nn))
+		nn, cmt := operand(join16(di.Raw[2], di.Raw[1]), labels)
+		return fmt.Sprintf("JP %s, %s%s", str[ln-4:ln-2], nn, cmt)
 	case OpcodeCALLZnn, OpcodeCALLCnn:
-		nn := join16(di.Raw[2], di.Raw[1])
-		return fmt.Sprintf("CALL %s, $%s%s", str[ln-3:ln-2], nn.Hex(), comment(nn))
+		nn, cmt := operand(join16(di.Raw[2], di.Raw[1]), labels)
+		return fmt.Sprintf("CALL %s, %s%s", str[ln-3:ln-2], nn, cmt)
 	case OpcodeCALLNZnn, OpcodeCALLNCnn:
-		nn := join16(di.Raw[2], di.Raw[1])
-		return fmt.Sprintf("CALL %s, $%s%s", str[ln-4:ln-2], nn.Hex(), comment(nn))
+		nn, cmt := operand(join16(di.Raw[2], di.Raw[1]), labels)
+		return fmt.Sprintf("CALL %s, %s%s", str[ln-4:ln-2], nn, cmt)
 	case OpcodeJRNZe, OpcodeJRNCe:
-		return fmt.Sprintf("JR %s, PC%s", str[ln-3:ln-1], fmtSignedOffset(di.Raw[1]))
+		return fmt.Sprintf("JR %s, %s", str[ln-3:ln-1], di.jrTarget(labels))
 	case OpcodeJRZe, OpcodeJRCe:
-		return fmt.Sprintf("JR %s, PC%s", str[ln-2:ln-1], fmtSignedOffset(di.Raw[1]))
+		return fmt.Sprintf("JR %s, %s", str[ln-2:ln-1], di.jrTarget(labels))
 	case OpcodeJRe:
-		return fmt.Sprintf("JR PC%s", fmtSignedOffset(di.Raw[1]))
+		return fmt.Sprintf("JR %s", di.jrTarget(labels))
 	case OpcodeLDAn, OpcodeLDBn, OpcodeLDCn, OpcodeLDDn, OpcodeLDEn, OpcodeLDHn, OpcodeLDLn:
 		return fmt.Sprintf("LD %s, $%s", str[ln-2:ln-1], di.Raw[1].Hex())
 	case OpcodeADDHLHL, OpcodeADDHLDE, OpcodeADDHLBC, OpcodeADDHLSP:
 		return fmt.Sprintf("ADD %s, %s", str[ln-4:ln-2], str[ln-2:])
 	case OpcodeLDHnA:
 		loc := join16(0xff, di.Raw[1])
+		if label, ok := label(Addr(loc), labels); ok {
+			return fmt.Sprintf("LDH (%s)", label)
+		}
 		return fmt.Sprintf("LDH ($ff00+$%s)%s", di.Raw[1].Hex(), comment(loc))
 	case OpcodeLDHAn:
 		loc := join16(0xff, di.Raw[1])
+		if label, ok := label(Addr(loc), labels); ok {
+			return fmt.Sprintf("LDH A,(%s)", label)
+		}
 		return fmt.Sprintf("LDH A,($ff00+$%s)%s", di.Raw[1].Hex(), comment(loc))
 	case OpcodeLDHAC:
 		return "LDH A,($ff00+C)"
@@ -185,6 +207,14 @@ func (di *DisInstruction) Asm() string {
 	return ""
 }
 
+// Label of the jump target if there is one, otherwise the offset from PC
+func (di *DisInstruction) jrTarget(labels Labeler) string {
+	if label, ok := label(di.Address+2+Addr(int8(di.Raw[1])), labels); ok {
+		return label
+	}
+	return "PC" + fmtSignedOffset(di.Raw[1])
+}
+
 func fmtSignedOffset(offs Data8) string {
 	if offs&SignBit8 != 0 {
 		return fmt.Sprintf("-$%s", offs.SignedAbs().Hex())
@@ -211,7 +241,8 @@ type Disassembly struct {
 	Data []DataSection
 }
 
-func (d *Disassembly) Print(w io.Writer) {
+// Prints the disassembly, with addresses replaced by labels if labels is not nil
+func (d *Disassembly) Print(w io.Writer, labels Labeler) {
 	data := splitSections(d.Data)
 
 	nCodeSections := len(d.Code)
@@ -238,7 +269,7 @@ func (d *Disassembly) Print(w io.Writer) {
 			selectCode = false
 		}
 		if selectCode {
-			printCodeSection(w, codeSection, d.PC)
+			printCodeSection(w, codeSection, d.PC, labels)
 			iCode++
 		} else {
 			if prevDataEndAddr != dataSection.Address {
@@ -251,13 +282,16 @@ func (d *Disassembly) Print(w io.Writer) {
 	}
 }
 
-func printCodeSection(w io.Writer, section *CodeSection, pc Addr) {
+func printCodeSection(w io.Writer, section *CodeSection, pc Addr, labels Labeler) {
 	fmt.Fprintf(w, "\nCode section at %s\n", section.Address().Hex())
 	for _, inst := range section.Instructions {
+		if label, ok := label(inst.Address, labels); ok {
+			fmt.Fprintf(w, "%s:\n", label)
+		}
 		if inst.Address == pc {
-			fmt.Fprintf(w, "[%s]->%s\n", inst.Address.Hex(), inst.Asm())
+			fmt.Fprintf(w, "[%s]->%s\n", inst.Address.Hex(), inst.Asm(labels))
 		} else {
-			fmt.Fprintf(w, "%sh | %s\n", inst.Address.Hex(), inst.Asm())
+			fmt.Fprintf(w, "%sh | %s\n", inst.Address.Hex(), inst.Asm(labels))
 		}
 	}
 }
@@ -451,7 +485,7 @@ func (dis *Disassembler) exploreFromInner(address Addr) {
 
 		di, err := dis.readNewInstruction(address, block)
 		if err != nil {
-			panicf("failed decoding at %v: %v", address.Hex(), err)
+			dis.print(fmt.Sprintf("failed decoding at %v: %v", address.Hex(), err))
 			return
 		}
 
@@ -501,7 +535,9 @@ func (dis *Disassembler) Disassembly(start, end Addr) *Disassembly {
 
 		beginOffs := start - block.Begin
 		// align to instruction
-		beginOffs -= start - block.Decoded[beginOffs].Address
+		if di := block.Decoded[beginOffs]; di.Size() > 0 {
+			beginOffs = di.Address - block.Begin
+		}
 
 		endOffs := end - block.Begin
 
@@ -544,10 +580,7 @@ func (dis *Disassembler) Disassembly(start, end Addr) *Disassembly {
 
 func (dis *Disassembler) insert(di DisInstruction, block *Block) {
 	if dis.Trace {
-		dis.print(fmt.Sprintf("insert %s at %s:%s", di.Asm(), di.Address.Hex(), (di.Address + Addr(di.Size()) - 1).Hex()))
-	}
-	if di.Address == 0xa8 {
-		panic("here")
+		dis.print(fmt.Sprintf("insert %s at %s:%s", di.Asm(nil), di.Address.Hex(), (di.Address + Addr(di.Size()) - 1).Hex()))
 	}
 	for addr := di.Address; addr != di.Address+Addr(di.Size()); addr++ {
 		block.Decoded[addr-block.Begin] = di
@@ -562,7 +595,7 @@ func (dis *Disassembler) checkBranches(di DisInstruction, block *Block) bool {
 
 		// branch taken
 		if dis.Trace {
-			dis.print("checking branch-taken for relative jump @ " + di.Asm())
+			dis.print("checking branch-taken for relative jump @ " + di.Asm(nil))
 		}
 		if e > 0 {
 			dis.ExploreFrom(di.Address + Addr(di.Size()) + Addr(e))
@@ -579,7 +612,7 @@ func (dis *Disassembler) checkBranches(di DisInstruction, block *Block) bool {
 		OpcodeCALLnn, OpcodeCALLCnn, OpcodeCALLNCnn, OpcodeCALLZnn, OpcodeCALLNZnn:
 		addr := Addr(join16(di.Raw[2], di.Raw[1]))
 		if dis.Trace {
-			dis.print("checking branch-taken for absolute jump @ " + di.Asm())
+			dis.print("checking branch-taken for absolute jump @ " + di.Asm(nil))
 		}
 		dis.ExploreFrom(addr)
 		if di.Opcode == OpcodeJPnn || di.Opcode == OpcodeJPHL {
@@ -689,6 +722,9 @@ func (dis *Disassembler) readNewInstruction(addr Addr, block *Block) (DisInstruc
 	if di.Size() == 0 {
 		return di, fmt.Errorf("no size set for opcode %v (0x%x)", di.Opcode, int(di.Opcode))
 	}
+	if int(addr-block.Begin)+int(di.Size()) > len(block.Source) {
+		return di, fmt.Errorf("instruction runs past the end")
+	}
 	for i := range Addr(di.Size()) {
 		di.Raw[i] = block.Source[di.Address+i-block.Begin]
 	}
@@ -20,6 +20,7 @@ type Gameboy struct {
 	Joypad      Joypad
 	Interrupts  Interrupts
 	Timer       Timer
+	Serial      Serial
 	BootROMLock BootROMLock
 	TCycle      uint
 	MCycle      uint
@@ -49,7 +50,7 @@ func Pause(clk *ClockRT, runFlag *atomic.Bool) {
 func (gb *Gameboy) AllocMem() {
 	gb.Mem = make([]Data8, 65536)
 	gb.Cartridge.ROM = make([][ROMBankSize]Data8, 512)
-	gb.Cartridge.RAM = make([][RAMBankSize]Data8, 4)
+	gb.Cartridge.RAM = make([][RAMBankSize]Data8, 16)
 }
 
 func (gb *Gameboy) Init(config *Config, clk *ClockRT) {
@@ -83,14 +84,21 @@ func (gb *Gameboy) initDebug(config *Config) {
 		Debugger:     NewDebugger(),
 		Disassembler: NewDisassembler(&config.Debug.Disassembler),
 		Warnings:     map[string]UserMessage{},
+		StubLY:       config.Debug.StubLY,
 	}
+	gb.linkDebugViews()
+}
+
+// The debug views refer directly into memory, so they must be relinked whenever Mem is replaced
+func (gb *Gameboy) linkDebugViews() {
 	gb.Debug.HRAM.Source = gb.Mem[AddrHRAMBegin : AddrHRAMEnd+1]
 	gb.Debug.WRAM.Source = gb.Mem[AddrWRAMBegin : AddrWRAMEnd+1]
 }
 
 func (gb *Gameboy) initCartridge() {
 	gb.Cartridge.RegLow = 1
-	gb.Cartridge.SelectedROMBank0 = 1
+	gb.Cartridge.SelectedROMBank0 = 0
+	gb.Cartridge.SelectedROMBank1 = 1
 }
 
 func (gb *Gameboy) initJoypad() {
@@ -119,28 +127,45 @@ func (gb *Gameboy) initPPU() {
 func (gb *Gameboy) WriteAddress(addr Addr) {
 	gb.Address = addr
 	gb.Data = gb.ProbeAddress(addr)
+	gb.Debug.busAccess(addr, gb.Data, gb.Data, false)
 }
 
 const LowestSpecialAddress = AddrP1
 
 func (gb *Gameboy) ProbeAddress(addr Addr) Data8 {
-	if addr < LowestSpecialAddress || gb.PureRAM {
+	if gb.PureRAM {
+		return gb.Mem[addr]
+	}
+	if addr <= AddrCartridgeBankNEnd {
+		return gb.ReadCartridgeROM(addr)
+	}
+	if addr >= AddrCartridgeRAMBegin && addr <= AddrCartridgeRAMEnd {
+		return gb.ReadCartridgeRAM(addr)
+	}
+	if addr < LowestSpecialAddress {
 		return gb.Mem[addr]
 	}
 
 	if addr >= AddrAPUBegin && addr <= AddrAPUEnd {
 		return gb.APU.Read(addr)
 	}
+	if addr == AddrLY && gb.Debug.StubLY {
+		return 0x90
+	}
 	if addr >= AddrPPUBegin && addr <= AddrPPUEnd {
 		return gb.PPU.Read(addr)
 	}
 	if addr == AddrP1 {
 		return gb.Joypad.Read(gb.Mem[AddrP1], addr)
 	}
+	if addr == AddrSB || addr == AddrSC {
+		return gb.ReadSerial(addr)
+	}
 	return gb.Mem[addr]
 }
 
 func (gb *Gameboy) WriteData(v Data8) {
+	gb.Debug.busAccess(gb.Address, gb.Data, v, true)
 	if gb.PureRAM {
 		gb.Mem[gb.Address] = v
 		return
@@ -159,19 +184,23 @@ func (gb *Gameboy) WriteData(v Data8) {
 		gb.WriteCartridge(addr, v)
 		return
 	}
+	if addr >= AddrCartridgeRAMBegin && addr <= AddrCartridgeRAMEnd {
+		gb.WriteCartridgeRAM(addr, v)
+		return
+	}
 	gb.Mem[addr] = v
 
 	if addr == AddrBootROMLock {
 		gb.WriteBootROMLock(v)
 	} else if addr == AddrP1 {
 		gb.WriteJoypad(addr, v)
-	} else if addr == AddrIF || addr == AddrIE {
-		gb.IRQCheck()
 	} else if addr >= AddrAPUBegin && addr <= AddrAPUEnd {
 		gb.APU.Write(addr, v)
 	} else if addr >= AddrPPUBegin && addr <= AddrPPUEnd {
 		gb.WritePPU(addr, v)
 	} else if addr >= AddrTimerBegin && addr <= AddrTimerEnd {
 		gb.Timer.Write(addr, v)
+	} else if addr == AddrSB || addr == AddrSC {
+		gb.WriteSerial(addr, v)
 	}
 }
@@ -0,0 +1,619 @@
+package model
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Server for the GDB remote serial protocol, so that GDB or other debugger front-ends can attach over TCP
+// with e.g. "target remote localhost:2345".
+//
+// Registers are af, bc, de, hl, sp and pc, 16 bits each, described to the client in target.xml.
+// pc is the address of the instruction being executed, or of the next one when stopped between instructions.
+// Memory is read with ProbeAddress, and written through the bus like CPU writes.
+// Breakpoints (Z0/Z1) and watchpoints (Z2/Z3/Z4) are added to the Debugger, so they also show up in the UI.
+//
+// The clock is paused while the client has the target stopped. One client is served at a time.
+type GDBServer struct {
+	gb       *Gameboy
+	clk      *ClockRT
+	listener net.Listener
+	stops    chan uint
+	killed   chan struct{}
+	done     chan struct{}
+	kill     sync.Once
+	noAck    atomic.Bool
+
+	// Breakpoint IDs by Z packet type, address and kind
+	breakpoints map[string][]int
+
+	// Cycle of the stop the client was last told about. Notifications for it are stale once the clock is resumed.
+	at uint
+}
+
+// How long to wait for the clock to reach an instruction boundary when the client interrupts,
+// before stopping wherever it is. The CPU may be halted, or the clock paused by the UI.
+const gdbHaltTimeout = 50 * time.Millisecond
+
+const gdbPacketSize = 0x1000
+
+const gdbTargetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.toyboy.sm83">
+    <reg name="af" bitsize="16" type="int"/>
+    <reg name="bc" bitsize="16" type="int"/>
+    <reg name="de" bitsize="16" type="int"/>
+    <reg name="hl" bitsize="16" type="data_ptr"/>
+    <reg name="sp" bitsize="16" type="data_ptr"/>
+    <reg name="pc" bitsize="16" type="code_ptr"/>
+  </feature>
+</target>
+`
+
+// Listens for GDB clients on addr (e.g. "localhost:2345") without blocking
+func ListenGDB(addr string, gb *Gameboy, clk *ClockRT) (*GDBServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("gdb: %w", err)
+	}
+	s := &GDBServer{
+		gb:          gb,
+		clk:         clk,
+		listener:    listener,
+		stops:       make(chan uint, 1),
+		killed:      make(chan struct{}),
+		done:        make(chan struct{}),
+		breakpoints: map[string][]int{},
+	}
+	clk.AttachBreakListener(s.onBreak)
+	go s.accept()
+	return s, nil
+}
+
+func (s *GDBServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Closed when the client kills the target
+func (s *GDBServer) Killed() <-chan struct{} {
+	return s.killed
+}
+
+func (s *GDBServer) Close() error {
+	close(s.done)
+	return s.listener.Close()
+}
+
+// Keeps the latest stop
+func (s *GDBServer) onBreak() {
+	for {
+		select {
+		case s.stops <- s.clk.Cycle:
+			return
+		default:
+			select {
+			case <-s.stops:
+			default:
+			}
+		}
+	}
+}
+
+func (s *GDBServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.serve(conn)
+	}
+}
+
+func (s *GDBServer) serve(conn net.Conn) {
+	defer conn.Close()
+	s.noAck.Store(false)
+	packets := make(chan string)
+	quit := make(chan struct{})
+	defer close(quit)
+	go s.receive(conn, packets, quit)
+
+	if !s.halt() {
+		return
+	}
+	running := false
+	for {
+		select {
+		case pkt, ok := <-packets:
+			if !ok {
+				if !running {
+					s.removeBreakpoints()
+					s.resume()
+				}
+				return
+			}
+			if pkt == "\x03" {
+				if running && s.halt() {
+					running = false
+					s.send(conn, "S02")
+				}
+				continue
+			}
+			if running {
+				continue
+			}
+			reply, action := s.handle(pkt)
+			if action == gdbReply || action == gdbDetach {
+				s.send(conn, reply)
+			}
+			switch action {
+			case gdbContinue:
+				s.resume()
+				running = true
+			case gdbDetach:
+				s.removeBreakpoints()
+				s.resume()
+				return
+			case gdbKill:
+				s.removeBreakpoints()
+				s.resume()
+				s.kill.Do(func() { close(s.killed) })
+				return
+			}
+		case cycle := <-s.stops:
+			if running && cycle != s.at {
+				running = false
+				s.at = cycle
+				s.clk.PauseAfterFetch.Store(false)
+				s.send(conn, "S05")
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Reads packets and interrupts ("\x03") from the client, acknowledging packets unless in no-ack mode
+func (s *GDBServer) receive(conn net.Conn, packets chan<- string, quit <-chan struct{}) {
+	defer close(packets)
+	r := bufio.NewReader(conn)
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		var data string
+		switch c {
+		case 0x03:
+			data = "\x03"
+		case '$':
+			if data, err = r.ReadString('#'); err != nil {
+				return
+			}
+			data = data[:len(data)-1]
+			var sum [2]byte
+			if _, err := io.ReadFull(r, sum[:]); err != nil {
+				return
+			}
+			if !s.noAck.Load() {
+				if want, err := strconv.ParseUint(string(sum[:]), 16, 8); err != nil || byte(want) != gdbChecksum(data) {
+					conn.Write([]byte("-"))
+					continue
+				}
+				conn.Write([]byte("+"))
+			}
+		default:
+			// Acks
+			continue
+		}
+		select {
+		case packets <- data:
+		case <-quit:
+			return
+		}
+	}
+}
+
+func (s *GDBServer) send(conn net.Conn, data string) {
+	var b strings.Builder
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '$', '#', '}', '*':
+			b.WriteByte('}')
+			b.WriteByte(c ^ 0x20)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	escaped := b.String()
+	fmt.Fprintf(conn, "$%s#%02x", escaped, gdbChecksum(escaped))
+}
+
+func gdbChecksum(data string) byte {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+// Stops the clock at the next instruction boundary and waits for it to stop.
+// Returns false if the server was closed.
+func (s *GDBServer) halt() bool {
+	if s.clk.Running.Load() {
+		// Notifications from before the clock was last resumed are stale
+		select {
+		case <-s.stops:
+		default:
+		}
+	}
+	s.clk.PauseAfterFetch.Store(true)
+	select {
+	case s.at = <-s.stops:
+		s.clk.PauseAfterFetch.Store(false)
+		return true
+	case <-s.done:
+		return false
+	case <-time.After(gdbHaltTimeout):
+	}
+	if s.clk.PauseAfterFetch.Swap(false) {
+		s.clk.PauseAfterCycle.Add(1)
+		s.clk.TryStart()
+	}
+	select {
+	case s.at = <-s.stops:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+func (s *GDBServer) resume() {
+	s.clk.Start()
+}
+
+type gdbAction int
+
+const (
+	gdbReply gdbAction = iota
+	gdbContinue
+	gdbDetach
+	gdbKill
+)
+
+// Handles a packet while the target is stopped
+func (s *GDBServer) handle(pkt string) (string, gdbAction) {
+	if pkt == "" {
+		return "", gdbReply
+	}
+	args := pkt[1:]
+	switch pkt[0] {
+	case '?':
+		return "S05", gdbReply
+	case 'c':
+		if args != "" {
+			if err := s.setPC(args); err != nil {
+				return "E01", gdbReply
+			}
+		}
+		return "", gdbContinue
+	case 's':
+		if args != "" {
+			if err := s.setPC(args); err != nil {
+				return "E01", gdbReply
+			}
+		}
+		s.clk.PauseAfterFetch.Store(true)
+		return "", gdbContinue
+	case 'D':
+		return "OK", gdbDetach
+	case 'k':
+		return "", gdbKill
+	case 'g':
+		var regs [6]Data16
+		s.clk.Sync(func() { regs = s.readRegs() })
+		var b strings.Builder
+		for _, v := range regs {
+			fmt.Fprintf(&b, "%02x%02x", v.LSB(), v.MSB())
+		}
+		return b.String(), gdbReply
+	case 'G':
+		if len(args) != 6*4 {
+			return "E01", gdbReply
+		}
+		var regs [6]Data16
+		for i := range regs {
+			v, err := gdbParseReg(args[i*4 : i*4+4])
+			if err != nil {
+				return "E01", gdbReply
+			}
+			regs[i] = v
+		}
+		s.clk.Sync(func() {
+			for i, v := range regs {
+				s.writeReg(i, v)
+			}
+		})
+		return "OK", gdbReply
+	case 'p':
+		n, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || n >= 6 {
+			return "E01", gdbReply
+		}
+		var v Data16
+		s.clk.Sync(func() { v = s.readRegs()[n] })
+		return fmt.Sprintf("%02x%02x", v.LSB(), v.MSB()), gdbReply
+	case 'P':
+		reg, value, _ := strings.Cut(args, "=")
+		n, err := strconv.ParseUint(reg, 16, 8)
+		if err != nil || n >= 6 {
+			return "E01", gdbReply
+		}
+		v, err := gdbParseReg(value)
+		if err != nil {
+			return "E01", gdbReply
+		}
+		s.clk.Sync(func() { s.writeReg(int(n), v) })
+		return "OK", gdbReply
+	case 'm':
+		addr, length, err := gdbParseRange(args)
+		if err != nil || length > gdbPacketSize/2 {
+			return "E01", gdbReply
+		}
+		var b strings.Builder
+		s.clk.Sync(func() {
+			for i := range length {
+				fmt.Fprintf(&b, "%02x", s.gb.ProbeAddress(addr+Addr(i)))
+			}
+		})
+		return b.String(), gdbReply
+	case 'M':
+		rng, hex, _ := strings.Cut(args, ":")
+		addr, length, err := gdbParseRange(rng)
+		if err != nil || len(hex) != 2*int(length) {
+			return "E01", gdbReply
+		}
+		data := make([]Data8, length)
+		for i := range data {
+			v, err := strconv.ParseUint(hex[2*i:2*i+2], 16, 8)
+			if err != nil {
+				return "E01", gdbReply
+			}
+			data[i] = Data8(v)
+		}
+		s.clk.Sync(func() { s.writeMem(addr, data) })
+		return "OK", gdbReply
+	case 'Z', 'z':
+		return s.handleBreakpoint(pkt[0] == 'Z', args), gdbReply
+	case 'H', 'T':
+		return "OK", gdbReply
+	case 'q', 'Q':
+		return s.handleQuery(pkt), gdbReply
+	}
+	return "", gdbReply
+}
+
+func (s *GDBServer) handleQuery(pkt string) string {
+	name, args, _ := strings.Cut(pkt, ":")
+	switch name {
+	case "qSupported":
+		return fmt.Sprintf("PacketSize=%x;qXfer:features:read+;QStartNoAckMode+", gdbPacketSize)
+	case "QStartNoAckMode":
+		s.noAck.Store(true)
+		return "OK"
+	case "qAttached":
+		return "1"
+	case "qC":
+		return "QC1"
+	case "qfThreadInfo":
+		return "m1"
+	case "qsThreadInfo":
+		return "l"
+	case "qSymbol":
+		return "OK"
+	case "qXfer":
+		// qXfer:features:read:target.xml:offset,length
+		fields := strings.Split(args, ":")
+		if len(fields) != 4 || fields[0] != "features" || fields[1] != "read" {
+			return ""
+		}
+		if fields[2] != "target.xml" {
+			return "E00"
+		}
+		offset, length, err := gdbParseRange(fields[3])
+		if err != nil {
+			return "E01"
+		}
+		if int(offset) >= len(gdbTargetXML) {
+			return "l"
+		}
+		chunk := gdbTargetXML[offset:]
+		if len(chunk) > int(length) {
+			return "m" + chunk[:length]
+		}
+		return "l" + chunk
+	}
+	return ""
+}
+
+// Z/z type,addr,kind. For watchpoints, kind is the number of bytes watched.
+func (s *GDBServer) handleBreakpoint(insert bool, args string) string {
+	fields := strings.Split(args, ",")
+	if len(fields) != 3 {
+		return "E01"
+	}
+	addr, err := strconv.ParseUint(fields[1], 16, 16)
+	if err != nil {
+		return "E01"
+	}
+	length, err := strconv.ParseUint(fields[2], 16, 16)
+	if err != nil {
+		return "E01"
+	}
+	var kinds []BreakpointKind
+	switch fields[0] {
+	case "0", "1":
+		kinds = []BreakpointKind{BreakpointKindPC}
+	case "2":
+		kinds = []BreakpointKind{BreakpointKindWrite}
+	case "3":
+		kinds = []BreakpointKind{BreakpointKindRead}
+	case "4":
+		kinds = []BreakpointKind{BreakpointKindRead, BreakpointKindWrite}
+	default:
+		return ""
+	}
+
+	dbg := &s.gb.Debug.Debugger
+	var reply string
+	s.clk.Sync(func() {
+		if !insert {
+			for _, id := range s.breakpoints[args] {
+				dbg.RemoveBreakpoint(id)
+			}
+			delete(s.breakpoints, args)
+			reply = "OK"
+			return
+		}
+		for _, kind := range kinds {
+			bp := Breakpoint{Kind: kind, Location: int64(addr), End: int64(addr), Enabled: true}
+			if kind.IsWatchpoint() && length > 1 {
+				bp.End = int64(addr + length - 1)
+			}
+			id, err := dbg.AddBreakpoint(bp)
+			if err != nil {
+				reply = "E01"
+				return
+			}
+			s.breakpoints[args] = append(s.breakpoints[args], id)
+		}
+		reply = "OK"
+	})
+	return reply
+}
+
+// Removes the client's breakpoints, so that they don't stop the clock after it has gone.
+// Must be called while the clock is paused.
+func (s *GDBServer) removeBreakpoints() {
+	s.clk.Sync(func() {
+		for _, ids := range s.breakpoints {
+			for _, id := range ids {
+				s.gb.Debug.Debugger.RemoveBreakpoint(id)
+			}
+		}
+	})
+	clear(s.breakpoints)
+}
+
+// Must be called from the clock's goroutine
+func (s *GDBServer) readRegs() [6]Data16 {
+	cpu := &s.gb.CPU
+	return [6]Data16{
+		join16(cpu.Regs.A, cpu.Regs.F),
+		cpu.GetBC(),
+		cpu.GetDE(),
+		cpu.GetHL(),
+		Data16(cpu.Regs.SP),
+		Data16(s.gb.gdbPC()),
+	}
+}
+
+// Must be called from the clock's goroutine
+func (s *GDBServer) writeReg(n int, v Data16) {
+	cpu := &s.gb.CPU
+	switch n {
+	case 0:
+		cpu.Regs.A, cpu.Regs.F = v.MSB(), v.LSB()&0xf0
+	case 1:
+		cpu.SetBC(v)
+	case 2:
+		cpu.SetDE(v)
+	case 3:
+		cpu.SetHL(v)
+	case 4:
+		cpu.SetSP(Addr(v))
+	case 5:
+		if Addr(v) != s.gb.gdbPC() {
+			s.gb.gdbJump(Addr(v))
+		}
+	}
+}
+
+// Must be called from the clock's goroutine
+func (s *GDBServer) writeMem(addr Addr, data []Data8) {
+	gb := s.gb
+	address, value, access := gb.Address, gb.Data, gb.Debug.Access
+	for i, v := range data {
+		gb.WriteAddress(addr + Addr(i))
+		gb.WriteData(v)
+	}
+	gb.Address, gb.Data, gb.Debug.Access = address, value, access
+}
+
+func (s *GDBServer) setPC(arg string) error {
+	pc, err := strconv.ParseUint(arg, 16, 16)
+	if err != nil {
+		return err
+	}
+	s.clk.Sync(func() { s.gb.gdbJump(Addr(pc)) })
+	return nil
+}
+
+// Address of the instruction being executed. Between instructions the next opcode has already been fetched.
+func (gb *Gameboy) gdbPC() Addr {
+	if gb.CPU.UOpCycle == 1 {
+		return gb.CPU.Regs.PC - 1
+	}
+	inst, _ := gb.CPU.CurrInstruction()
+	return inst.Address
+}
+
+// Abandons the current instruction and continues at pc, as if it was just fetched
+func (gb *Gameboy) gdbJump(pc Addr) {
+	cpu := &gb.CPU
+	cpu.Regs.IR = Opcode(gb.ProbeAddress(pc))
+	cpu.FetchAddr = pc
+	cpu.FetchPending = true
+	cpu.Regs.PC = pc + 1
+	cpu.UOpCycle = 1
+	cpu.Halted = false
+	cpu.Locked = false
+	cpu.HaltBug = false
+	cpu.Stopped = false
+}
+
+func gdbParseReg(hex string) (Data16, error) {
+	if len(hex) != 4 {
+		return 0, fmt.Errorf("invalid register value '%s'", hex)
+	}
+	v, err := strconv.ParseUint(hex, 16, 16)
+	if err != nil {
+		return 0, err
+	}
+	// Little-endian
+	return Data16(v>>8 | (v&0xff)<<8), nil
+}
+
+// Parses "addr,length" in hex
+func gdbParseRange(s string) (Addr, uint, error) {
+	a, l, ok := strings.Cut(s, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid range '%s'", s)
+	}
+	addr, err := strconv.ParseUint(a, 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err := strconv.ParseUint(l, 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	return Addr(addr), uint(length), nil
+}
@@ -35,10 +35,10 @@ func (cb CBOp) String() string {
 }
 
 var IRQHandler = InstructionHandler{
-	uIntermediateNop,
+	uDiscardFetch,
 	uIntermediateNop,
 	uPushPCMSB,
-	uPushPCLSB,
+	uPushPCLSBSelectISR,
 	uSetPCISR,
 }
 
@@ -194,6 +194,7 @@ var Handlers = HandlerArray{
 	OpcodeDI:       {di},
 	OpcodeEI:       {ei},
 	OpcodeHALT:     {halt},
+	OpcodeSTOP:     {stop},
 	OpcodeJRe:      {jre_1, jre_2, jre_3},
 	OpcodeJPnn:     {jpnn_1, jpnn_2, jpnn_3, jpnn_4},
 	OpcodeJPHL:     {jphl},
@@ -224,10 +225,10 @@ var Handlers = HandlerArray{
 	OpcodeRETNZ:    {retcc_1, retNZ_2, retcc_3, retcc_4, retcc_5},
 	OpcodeRETC:     {retcc_1, retC_2, retcc_3, retcc_4, retcc_5},
 	OpcodeRETNC:    {retcc_1, retNC_2, retcc_3, retcc_4, retcc_5},
-	OpcodePUSHBC:   {pushBC_1, pushBC_2, push_3, push_4},
-	OpcodePUSHDE:   {pushDE_1, pushDE_2, push_3, push_4},
-	OpcodePUSHHL:   {pushHL_1, pushHL_2, push_3, push_4},
-	OpcodePUSHAF:   {pushAF_1, pushAF_2, push_3, push_4},
+	OpcodePUSHBC:   {push_1, pushBC_2, pushBC_3, push_4},
+	OpcodePUSHDE:   {push_1, pushDE_2, pushDE_3, push_4},
+	OpcodePUSHHL:   {push_1, pushHL_2, pushHL_3, push_4},
+	OpcodePUSHAF:   {push_1, pushAF_2, pushAF_3, push_4},
 	OpcodePOPBC:    {pop1, pop2, popBC_3},
 	OpcodePOPDE:    {pop1, pop2, popDE_3},
 	OpcodePOPHL:    {pop1, pop2, popHL_3},
@@ -279,25 +280,25 @@ var Handlers = HandlerArray{
 	OpcodeLDHn:     {ldrn_1, ldHn_2},
 	OpcodeLDLn:     {ldrn_1, ldLn_2},
 	OpcodeCB:       {runCB_1, runCB_2, runCB_3, runCB_4},
-	OpcodeRST0x00:  {rst_1, rst_2, rst_3_00, rst_4},
-	OpcodeRST0x08:  {rst_1, rst_2, rst_3_08, rst_4},
-	OpcodeRST0x10:  {rst_1, rst_2, rst_3_10, rst_4},
-	OpcodeRST0x18:  {rst_1, rst_2, rst_3_18, rst_4},
-	OpcodeRST0x20:  {rst_1, rst_2, rst_3_20, rst_4},
-	OpcodeRST0x28:  {rst_1, rst_2, rst_3_28, rst_4},
-	OpcodeRST0x30:  {rst_1, rst_2, rst_3_30, rst_4},
-	OpcodeRST0x38:  {rst_1, rst_2, rst_3_38, rst_4},
-	OpcodeUndefD3:  {endNoop},
-	OpcodeUndefDB:  {endNoop},
-	OpcodeUndefDD:  {endNoop},
-	OpcodeUndefE3:  {endNoop},
-	OpcodeUndefE4:  {endNoop},
-	OpcodeUndefEB:  {endNoop},
-	OpcodeUndefEC:  {endNoop},
-	OpcodeUndefED:  {endNoop},
-	OpcodeUndefF4:  {endNoop},
-	OpcodeUndefFC:  {endNoop},
-	OpcodeUndefFD:  {endNoop},
+	OpcodeRST0x00:  {rst_1, rst_2, rst_3, rst_4_00},
+	OpcodeRST0x08:  {rst_1, rst_2, rst_3, rst_4_08},
+	OpcodeRST0x10:  {rst_1, rst_2, rst_3, rst_4_10},
+	OpcodeRST0x18:  {rst_1, rst_2, rst_3, rst_4_18},
+	OpcodeRST0x20:  {rst_1, rst_2, rst_3, rst_4_20},
+	OpcodeRST0x28:  {rst_1, rst_2, rst_3, rst_4_28},
+	OpcodeRST0x30:  {rst_1, rst_2, rst_3, rst_4_30},
+	OpcodeRST0x38:  {rst_1, rst_2, rst_3, rst_4_38},
+	OpcodeUndefD3:  {undefined},
+	OpcodeUndefDB:  {undefined},
+	OpcodeUndefDD:  {undefined},
+	OpcodeUndefE3:  {undefined},
+	OpcodeUndefE4:  {undefined},
+	OpcodeUndefEB:  {undefined},
+	OpcodeUndefEC:  {undefined},
+	OpcodeUndefED:  {undefined},
+	OpcodeUndefF4:  {undefined},
+	OpcodeUndefFC:  {undefined},
+	OpcodeUndefFD:  {undefined},
 }
 
 func noop(gb *Gameboy) bool {
@@ -331,8 +332,40 @@ func jphl(gb *Gameboy) bool {
 	return true
 }
 
+// The CPU stops fetching instructions and ignores interrupts until it is reset
+func undefined(gb *Gameboy) bool {
+	gb.CPU.Locked = true
+	gb.Debug.SetWarning("undefined opcode", fmt.Sprintf("CPU locked up after executing undefined opcode %s at %s", Data8(gb.CPU.Regs.IR).Hex(), (gb.CPU.Regs.PC-1).Hex()))
+	return false
+}
+
+// With IME set, a requested interrupt is dispatched before HALT executes. If one is requested while IME isn't set,
+// HALT doesn't halt and there's the HALT bug: the next opcode is fetched without incrementing PC,
+// so the byte after HALT is read twice. IME isn't set yet right after EI, so EI / HALT returns to the HALT.
 func halt(gb *Gameboy) bool {
-	gb.CPU.Halted = true
+	if gb.requestedInterrupt() == IntSourceNone {
+		gb.CPU.Halted = true
+	} else if !gb.Interrupts.IME {
+		gb.CPU.HaltBug = true
+	}
+	return true
+}
+
+// https://gbdev.io/pandocs/Reducing_Power_Consumption.html#using-the-stop-instruction
+// With a button held, STOP enters HALT mode, or does nothing if an interrupt is requested.
+// Otherwise it enters STOP mode and resets DIV. STOP skips the byte after it unless an interrupt is requested.
+func stop(gb *Gameboy) bool {
+	irq := gb.requestedInterrupt() != IntSourceNone
+	if !irq {
+		gb.CPU.IncPC()
+	}
+	if gb.joypadLow() {
+		gb.CPU.Halted = !irq
+		return true
+	}
+	gb.CPU.Stopped = true
+	gb.Timer.Write(AddrDIV, 0)
+	gb.Mem[AddrDIV] = 0
 	return true
 }
 
@@ -380,8 +413,9 @@ func jpnn_4(gb *Gameboy) bool {
 }
 
 func jrcce_1(gb *Gameboy) bool {
-	gb.CPU.Regs.TempZ = gb.ProbeAddress(gb.CPU.Regs.PC)
+	gb.WriteAddress(gb.CPU.Regs.PC)
 	gb.CPU.IncPC()
+	gb.CPU.Regs.TempZ = gb.Data
 	return false
 }
 
@@ -438,63 +472,63 @@ func jpccnn_3(gb *Gameboy, cond bool) bool {
 
 var jpccnn_4 = endNoop
 
-func pushAF_1(gb *Gameboy) bool {
+func pushAF_2(gb *Gameboy) bool {
 	gb.CPU.SetSP(gb.CPU.Regs.SP - 1)
 	gb.WriteAddress(gb.CPU.Regs.SP)
 	gb.WriteData(gb.CPU.Regs.A)
 	return false
 }
 
-func pushAF_2(gb *Gameboy) bool {
+func pushAF_3(gb *Gameboy) bool {
 	gb.CPU.SetSP(gb.CPU.Regs.SP - 1)
 	gb.WriteAddress(gb.CPU.Regs.SP)
 	gb.WriteData(gb.CPU.Regs.F)
 	return false
 }
 
-func pushBC_1(gb *Gameboy) bool {
+func pushBC_2(gb *Gameboy) bool {
 	gb.CPU.SetSP(gb.CPU.Regs.SP - 1)
 	gb.WriteAddress(gb.CPU.Regs.SP)
 	gb.WriteData(gb.CPU.Regs.B)
 	return false
 }
 
-func pushBC_2(gb *Gameboy) bool {
+func pushBC_3(gb *Gameboy) bool {
 	gb.CPU.SetSP(gb.CPU.Regs.SP - 1)
 	gb.WriteAddress(gb.CPU.Regs.SP)
 	gb.WriteData(gb.CPU.Regs.C)
 	return false
 }
 
-func pushDE_1(gb *Gameboy) bool {
+func pushDE_2(gb *Gameboy) bool {
 	gb.CPU.SetSP(gb.CPU.Regs.SP - 1)
 	gb.WriteAddress(gb.CPU.Regs.SP)
 	gb.WriteData(gb.CPU.Regs.D)
 	return false
 }
 
-func pushDE_2(gb *Gameboy) bool {
+func pushDE_3(gb *Gameboy) bool {
 	gb.CPU.SetSP(gb.CPU.Regs.SP - 1)
 	gb.WriteAddress(gb.CPU.Regs.SP)
 	gb.WriteData(gb.CPU.Regs.E)
 	return false
 }
 
-func pushHL_1(gb *Gameboy) bool {
+func pushHL_2(gb *Gameboy) bool {
 	gb.CPU.SetSP(gb.CPU.Regs.SP - 1)
 	gb.WriteAddress(gb.CPU.Regs.SP)
 	gb.WriteData(gb.CPU.Regs.H)
 	return false
 }
 
-func pushHL_2(gb *Gameboy) bool {
+func pushHL_3(gb *Gameboy) bool {
 	gb.CPU.SetSP(gb.CPU.Regs.SP - 1)
 	gb.WriteAddress(gb.CPU.Regs.SP)
 	gb.WriteData(gb.CPU.Regs.L)
 	return false
 }
 
-var push_3 = noop
+var push_1 = noop
 var push_4 = endNoop
 
 func pop1(gb *Gameboy) bool {
@@ -850,8 +884,8 @@ func di(gb *Gameboy) bool {
 	return true
 }
 
+// Sets IME after the next instruction, see applyPendingIME
 func ei(gb *Gameboy) bool {
-	gb.Interrupts.SetIMENextCycle = true
 	return true
 }
 
@@ -1459,61 +1493,59 @@ func ldhlspe_3(gb *Gameboy) bool {
 	return true
 }
 
-func rst_1(gb *Gameboy) bool {
+var rst_1 = noop
+
+func rst_2(gb *Gameboy) bool {
 	gb.CPU.SetSP(gb.CPU.Regs.SP - 1)
 	gb.WriteAddress(gb.CPU.Regs.SP)
 	gb.WriteData(gb.CPU.Regs.PC.MSB())
 	return false
 }
 
-func rst_2(gb *Gameboy) bool {
+func rst_3(gb *Gameboy) bool {
 	gb.CPU.SetSP(gb.CPU.Regs.SP - 1)
 	gb.WriteAddress(gb.CPU.Regs.SP)
 	gb.WriteData(gb.CPU.Regs.PC.LSB())
 	return false
 }
 
-func rst_3_00(gb *Gameboy) bool {
+func rst_4_00(gb *Gameboy) bool {
 	gb.CPU.SetPC(0x0000)
-	return false
+	return true
 }
 
-func rst_3_08(gb *Gameboy) bool {
+func rst_4_08(gb *Gameboy) bool {
 	gb.CPU.SetPC(0x0008)
-	return false
+	return true
 }
 
-func rst_3_10(gb *Gameboy) bool {
+func rst_4_10(gb *Gameboy) bool {
 	gb.CPU.SetPC(0x0010)
-	return false
+	return true
 }
 
-func rst_3_18(gb *Gameboy) bool {
+func rst_4_18(gb *Gameboy) bool {
 	gb.CPU.SetPC(0x0018)
-	return false
+	return true
 }
 
-func rst_3_20(gb *Gameboy) bool {
+func rst_4_20(gb *Gameboy) bool {
 	gb.CPU.SetPC(0x0020)
-	return false
+	return true
 }
 
-func rst_3_28(gb *Gameboy) bool {
+func rst_4_28(gb *Gameboy) bool {
 	gb.CPU.SetPC(0x0028)
-	return false
+	return true
 }
 
-func rst_3_30(gb *Gameboy) bool {
+func rst_4_30(gb *Gameboy) bool {
 	gb.CPU.SetPC(0x0030)
-	return false
+	return true
 }
 
-func rst_3_38(gb *Gameboy) bool {
+func rst_4_38(gb *Gameboy) bool {
 	gb.CPU.SetPC(0x0038)
-	return false
-}
-
-func rst_4(gb *Gameboy) bool {
 	return true
 }
 
@@ -1700,6 +1732,12 @@ func uIntermediateNop(gb *Gameboy) bool {
 	return false
 }
 
+// The opcode fetched before the interrupt is executed when the ISR returns
+func uDiscardFetch(gb *Gameboy) bool {
+	gb.CPU.SetPC(gb.CPU.Regs.PC - 1)
+	return false
+}
+
 func uFetchZ(gb *Gameboy) bool {
 	gb.WriteAddress(gb.CPU.Regs.PC)
 	gb.CPU.IncPC()
@@ -1729,9 +1767,21 @@ func uSetPCWZ(gb *Gameboy) bool {
 	return true
 }
 
+// The interrupt is chosen after the upper byte of PC is pushed, which may have written to IE.
+// If none is requested anymore, the dispatch is cancelled and jumps to $0000.
+func uPushPCLSBSelectISR(gb *Gameboy) bool {
+	isr := Addr(0x0000)
+	if is := gb.requestedInterrupt(); is != IntSourceNone {
+		gb.Mem[AddrIF] &= ^is.Mask()
+		isr = is.ISR()
+	}
+	gb.CPU.Regs.SetWZ(Data16(isr))
+	gb.push(gb.CPU.Regs.PC.LSB())
+	return false
+}
+
 func uSetPCISR(gb *Gameboy) bool {
-	isr := gb.Interrupts.PendingInterrupt.ISR()
-	gb.CPU.SetPC(isr)
+	gb.CPU.SetPC(Addr(gb.CPU.Regs.GetWZ()))
 	gb.Interrupts.PendingInterrupt = 0
 	gb.Interrupts.InISR = true
 	return true
@@ -58,7 +58,7 @@ var instSize = [256]Size16{
 
 	OpcodeLDHnA: 2,
 	OpcodeLDHAn: 2,
-	OpcodeLDHAC: 2,
+	OpcodeLDHAC: 1,
 
 	OpcodeXORA:  1,
 	OpcodeXORB:  1,
@@ -46,43 +46,47 @@ func (is IntSource) ISR() Addr {
 
 func (gb *Gameboy) SetIME(v bool) {
 	gb.Interrupts.IME = v
-	if v {
-		gb.IRQCheck()
-	}
 }
 
+// Starts dispatching an interrupt at the next M-cycle. Which one is decided during the dispatch, see uPushPCLSBSelectISR.
 func (gb *Gameboy) PendInterrupt(in IntSource) {
 	gb.Interrupts.IME = false
-	gb.Mem[AddrIF] &= ^in.Mask()
 	gb.Interrupts.PendingInterrupt = in
-	gb.CPU.UOpCycle = 1
 }
 
 func (gb *Gameboy) IRQSet(in IntSource) {
-	if gb.Mem[AddrIF]&in.Mask() != 0 {
-		return
-	}
 	gb.Mem[AddrIF] |= in.Mask()
-	gb.IRQCheck()
 }
 
-func (gb *Gameboy) IRQCheck() {
+// The highest priority interrupt that is both requested and enabled, regardless of IME
+func (gb *Gameboy) requestedInterrupt() IntSource {
 	regIF := gb.Mem[AddrIF]
 	regIE := gb.Mem[AddrIE]
-	for is := IntSource(0); is < 5; is++ {
+	for is := IntSourceVBlank; is <= IntSourceJoypad; is++ {
 		if (regIF & regIE & is.Mask()) != 0 {
-			if gb.Interrupts.IME {
-				gb.PendInterrupt(is)
-			}
-			gb.CPU.Halted = false
-			break
+			return is
 		}
 	}
+	return IntSourceNone
 }
 
+// Called at each instruction boundary, before the fetched opcode executes
+func (gb *Gameboy) interruptCheck() {
+	if !gb.Interrupts.IME {
+		return
+	}
+	if is := gb.requestedInterrupt(); is != IntSourceNone {
+		gb.PendInterrupt(is)
+	}
+}
+
+// Called when an instruction is done. EI takes effect when the instruction after it is done, even if that is another EI.
 func (gb *Gameboy) applyPendingIME() {
 	if gb.Interrupts.SetIMENextCycle {
 		gb.Interrupts.SetIMENextCycle = false
 		gb.SetIME(true)
 	}
+	if gb.CPU.Regs.IR == OpcodeEI {
+		gb.Interrupts.SetIMENextCycle = true
+	}
 }
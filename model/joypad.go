@@ -32,50 +32,61 @@ func (jp *Joypad) Read(written Data8, addr Addr) Data8 {
 	return out
 }
 
+// Whether a selected button is pressed, which takes the CPU out of STOP mode
+func (gb *Gameboy) joypadLow() bool {
+	return gb.Joypad.Read(gb.Mem[AddrP1], AddrP1)&0x0f != 0x0f
+}
+
+// Applies the state at the start of the next M-cycle, so that the exact cycle can be recorded and replayed
 func (jp *Joypad) SetState(clk *ClockRT, gb *Gameboy, jps JoypadState) {
 	clk.Sync(func() {
-		actionMask := Data8(0b0000)
-		directionMask := Data8(0b0000)
-		if jps.A {
-			actionMask |= 0b0001
-		}
-		if jps.B {
-			actionMask |= 0b0010
-		}
-		if jps.Select {
-			actionMask |= 0b0100
-		}
-		if jps.Start {
-			actionMask |= 0b1000
-		}
-		if jps.Right {
-			directionMask |= 0b0001
-		}
-		if jps.Left {
-			directionMask |= 0b0010
-		}
-		if jps.Up {
-			directionMask |= 0b0100
-		}
-		if jps.Down {
-			directionMask |= 0b1000
-		}
+		clk.ScheduleInput(InputEvent{Cycle: clk.Cycle, State: jps})
+	})
+}
+
+// Same as SetState, but must be called from the clock's goroutine (or when the clock isn't running)
+func (jp *Joypad) Apply(gb *Gameboy, jps JoypadState) {
+	actionMask := Data8(0b0000)
+	directionMask := Data8(0b0000)
+	if jps.A {
+		actionMask |= 0b0001
+	}
+	if jps.B {
+		actionMask |= 0b0010
+	}
+	if jps.Select {
+		actionMask |= 0b0100
+	}
+	if jps.Start {
+		actionMask |= 0b1000
+	}
+	if jps.Right {
+		directionMask |= 0b0001
+	}
+	if jps.Left {
+		directionMask |= 0b0010
+	}
+	if jps.Up {
+		directionMask |= 0b0100
+	}
+	if jps.Down {
+		directionMask |= 0b1000
+	}
 
-		newAction := 0xf ^ actionMask
-		newDirection := 0xf ^ directionMask
+	newAction := 0xf ^ actionMask
+	newDirection := 0xf ^ directionMask
 
-		doJoypadInterrupt := false
-		if gb.Mem[AddrP1]&0x20 == 0 {
-			doJoypadInterrupt = (jp.Action & ^newAction) != 0
-		} else {
-			doJoypadInterrupt = (jp.Direction & ^newDirection) != 0
-		}
+	doJoypadInterrupt := false
+	if gb.Mem[AddrP1]&0x20 == 0 {
+		doJoypadInterrupt = (jp.Action & ^newAction) != 0
+	} else {
+		doJoypadInterrupt = (jp.Direction & ^newDirection) != 0
+	}
 
-		jp.Action = newAction
-		jp.Direction = newDirection
+	jp.Action = newAction
+	jp.Direction = newDirection
 
-		if doJoypadInterrupt {
-			gb.IRQSet(IntSourceJoypad)
-		}
-	})
+	if doJoypadInterrupt {
+		gb.IRQSet(IntSourceJoypad)
+	}
 }
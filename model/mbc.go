@@ -10,6 +10,9 @@ type MBCID uint8
 const (
 	ROMBankSize = 16 * 1024
 	RAMBankSize = 8 * 1024
+
+	// MBC2 has 512x4 bits of RAM built into the MBC itself
+	MBC2RAMSize = 512
 )
 
 type MBCFeatures struct {
@@ -47,6 +50,9 @@ func (mbcf *MBCFeatures) TotalROMSize() int {
 }
 
 func (mbcf *MBCFeatures) TotalRAMSize() int {
+	if mbcf.ID == MBCID2 {
+		return MBC2RAMSize
+	}
 	return RAMBankSize * mbcf.NRAMBanks
 }
 
@@ -66,6 +72,7 @@ func GetMBCFeatures(code, romsiz, ramsiz uint8) MBCFeatures {
 		mbc.Battery = true
 	case 0x05:
 		mbc.ID = MBCID2
+		mbc.RAM = true
 	case 0x06:
 		mbc.ID = MBCID2
 		mbc.RAM = true
@@ -151,7 +158,10 @@ func GetMBCFeatures(code, romsiz, ramsiz uint8) MBCFeatures {
 		panicf("rom size byte 0x%02x not supported", romsiz)
 	}
 
-	if mbc.RAM {
+	if mbc.ID == MBCID2 {
+		// The header says no RAM, but it's built into the MBC
+		mbc.NRAMBanks = 1
+	} else if mbc.RAM {
 		switch ramsiz {
 		case 2:
 			mbc.NRAMBanks = 1
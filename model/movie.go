@@ -0,0 +1,182 @@
+package model
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+)
+
+// Movie file layout:
+//
+//	magic (8 bytes) | version (uint32 LE) | movie (gzipped gob)
+const (
+	MovieMagic   = "TOYBOYMV"
+	MovieVersion = 1
+)
+
+// Joypad input recorded from a well-defined initial state, for reproducing a run exactly.
+// Input is applied at the start of the M-cycle given by its cycle, both when recording and playing back.
+type Movie struct {
+	Title          string
+	HeaderChecksum Data8
+	GlobalChecksum Data16
+	Timestamp      time.Time
+
+	// Save state (as written by EncodeSaveState) to start from, or empty to start from power-on
+	SaveState []byte
+
+	// When starting from power-on, whether the boot ROM was skipped with SkipBootROM
+	SkipBoot bool
+
+	// When starting from power-on, cartridge RAM and clock as loaded from the battery save.
+	// Playback starts from these rather than from whatever the battery save holds by then.
+	RAM [][RAMBankSize]Data8
+	RTC RTC
+
+	Inputs []InputEvent
+}
+
+func (gb *Gameboy) newMovie(now time.Time) *Movie {
+	hdr := gb.saveStateHeader(0, now)
+	return &Movie{
+		Title:          hdr.Title,
+		HeaderChecksum: hdr.HeaderChecksum,
+		GlobalChecksum: hdr.GlobalChecksum,
+		Timestamp:      now,
+	}
+}
+
+// Starts a movie at power-on. The Gameboy must not have run yet.
+func (gb *Gameboy) NewMovieFromPowerOn(skipBoot bool, now time.Time) *Movie {
+	movie := gb.newMovie(now)
+	movie.SkipBoot = skipBoot
+	movie.RAM = slices.Clone(gb.Cartridge.RAM)
+	movie.RTC = gb.Cartridge.RTC
+	return movie
+}
+
+// Starts a movie at the current state, which is embedded as a save state. Must be called from the clock's goroutine.
+func (gb *Gameboy) NewMovieFromState(clk *ClockRT, now time.Time) (*Movie, error) {
+	movie := gb.newMovie(now)
+	var buf bytes.Buffer
+	if err := gb.EncodeSaveState(&buf, clk.Cycle, now); err != nil {
+		return nil, err
+	}
+	movie.SaveState = buf.Bytes()
+	return movie, nil
+}
+
+// Input listener that records the input into the movie
+func (m *Movie) Record(ev InputEvent) {
+	m.Inputs = append(m.Inputs, ev)
+}
+
+// Puts the Gameboy in the initial state of the movie and schedules its input instead of any input already queued.
+// Must be called from the clock's goroutine.
+// For movies that start at power-on, the Gameboy must be freshly initialised, and have skipped the boot ROM if SkipBoot is set.
+// Battery saves are turned off by clearing Cartridge.BatteryPath, since the movie replaces cartridge RAM.
+func (m *Movie) Play(gb *Gameboy, clk *ClockRT) error {
+	have := gb.saveStateHeader(0, time.Time{})
+	if m.Title != have.Title || m.HeaderChecksum != have.HeaderChecksum || m.GlobalChecksum != have.GlobalChecksum {
+		return fmt.Errorf("movie is for '%s', but '%s' is loaded", m.Title, have.Title)
+	}
+	if len(m.SaveState) > 0 {
+		hdr, err := gb.DecodeSaveState(bytes.NewReader(m.SaveState))
+		if err != nil {
+			return fmt.Errorf("movie: %w", err)
+		}
+		clk.Cycle = hdr.Cycle
+		clk.frameCount = gb.PPU.FrameCount
+	} else if clk.Cycle != 0 {
+		return fmt.Errorf("movie starts at power-on, but the emulator has already run %d cycles", clk.Cycle)
+	} else if m.SkipBoot != gb.BootROMLock.BootOff {
+		return fmt.Errorf("movie was recorded with SkipBoot=%v", m.SkipBoot)
+	} else {
+		cart := &gb.Cartridge
+		for bank := range cart.RAM {
+			cart.RAM[bank] = [RAMBankSize]Data8{}
+		}
+		copy(cart.RAM, m.RAM)
+		cart.RTC = m.RTC
+	}
+	gb.Cartridge.BatteryPath = ""
+	clk.inputs = nil
+	for _, ev := range m.Inputs {
+		clk.ScheduleInput(ev)
+	}
+	return nil
+}
+
+// Cycle at which the last input is applied
+func (m *Movie) End() uint {
+	if len(m.Inputs) == 0 {
+		return 0
+	}
+	return m.Inputs[len(m.Inputs)-1].Cycle
+}
+
+func (m *Movie) Encode(w io.Writer) error {
+	var prefix [12]byte
+	copy(prefix[:8], MovieMagic)
+	binary.LittleEndian.PutUint32(prefix[8:], MovieVersion)
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(w)
+	if err := gob.NewEncoder(gz).Encode(m); err != nil {
+		return fmt.Errorf("encoding movie: %w", err)
+	}
+	return gz.Close()
+}
+
+func DecodeMovie(r io.Reader) (*Movie, error) {
+	var prefix [12]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, fmt.Errorf("reading movie: %w", err)
+	}
+	if string(prefix[:8]) != MovieMagic {
+		return nil, fmt.Errorf("not a movie")
+	}
+	if version := binary.LittleEndian.Uint32(prefix[8:]); version != MovieVersion {
+		return nil, fmt.Errorf("movie version %d is not supported", version)
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading movie: %w", err)
+	}
+	var m Movie
+	if err := gob.NewDecoder(gz).Decode(&m); err != nil {
+		return nil, fmt.Errorf("decoding movie: %w", err)
+	}
+	return &m, nil
+}
+
+func (m *Movie) Save(path string) error {
+	var buf bytes.Buffer
+	if err := m.Encode(&buf); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o666); err != nil {
+		return fmt.Errorf("writing movie: %w", err)
+	}
+	return nil
+}
+
+func LoadMovie(path string) (*Movie, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening movie: %w", err)
+	}
+	defer f.Close()
+	m, err := DecodeMovie(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
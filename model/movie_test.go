@@ -0,0 +1,87 @@
+package model_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jonathangjertsen/toyboy/model"
+)
+
+func TestMoviePowerOnBattery(t *testing.T) {
+	// MBC3+TIMER+RAM+BATTERY, 32 KiB RAM
+	gb, _ := newCartridgeGameboy(0x10, 0x02, 0x03)
+	fillCartridgeRAM(gb)
+	setRTC(&gb.Cartridge.RTC, 3, 4, 5, 6)
+	movie := gb.NewMovieFromPowerOn(gb.BootROMLock.BootOff, time.Unix(1_700_000_000, 0))
+	movie.Record(model.InputEvent{Cycle: 8, State: model.JoypadState{A: true}})
+
+	// The battery save has changed since recording, and the clock has input queued
+	played, clk := newCartridgeGameboy(0x10, 0x02, 0x03)
+	played.Cartridge.RAM[2][5] = 0x42
+	setRTC(&played.Cartridge.RTC, 9, 9, 9, 9)
+	clk.ScheduleInput(model.InputEvent{Cycle: 4, State: model.JoypadState{B: true}})
+	var inputs []model.InputEvent
+	clk.AttachInputListener(func(ev model.InputEvent) {
+		inputs = append(inputs, ev)
+	})
+
+	if err := movie.Play(played, clk); err != nil {
+		t.Fatal(err)
+	}
+	for bank := range 4 {
+		if played.Cartridge.RAM[bank] != gb.Cartridge.RAM[bank] {
+			t.Fatalf("want RAM bank %d from the movie", bank)
+		}
+	}
+	checkRTC(t, &played.Cartridge.RTC, 3, 4, 5, 6)
+
+	audio, devnull := model.AudioStub()
+	defer close(devnull)
+	fs := model.FrameSync{}
+	clk.MCycle(4, played, audio, &fs)
+	if len(inputs) != 1 || inputs[0] != movie.Inputs[0] {
+		t.Fatalf("want only the movie's input applied, have %v", inputs)
+	}
+}
+
+func TestMovieBatterySave(t *testing.T) {
+	// MBC5+RAM+BATTERY, 32 KiB RAM
+	gb, _ := newCartridgeGameboy(0x1b, 0x02, 0x03)
+	gb.Cartridge.BatteryPath = filepath.Join(t.TempDir(), "game.sav")
+	fillCartridgeRAM(gb)
+	gb.Cartridge.BatteryDirty = true
+	if err := gb.FlushBattery(); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(gb.Cartridge.BatteryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Recorded on another machine with a different battery save
+	recorder, _ := newCartridgeGameboy(0x1b, 0x02, 0x03)
+	recorder.Cartridge.RAM[1][7] = 0x42
+	movie := recorder.NewMovieFromPowerOn(recorder.BootROMLock.BootOff, time.Unix(1_700_000_000, 0))
+
+	played, clk := newCartridgeGameboy(0x1b, 0x02, 0x03)
+	played.Cartridge.BatteryPath = gb.Cartridge.BatteryPath
+	if err := played.LoadBattery(); err != nil {
+		t.Fatal(err)
+	}
+	if err := movie.Play(played, clk); err != nil {
+		t.Fatal(err)
+	}
+	played.Cartridge.BatteryDirty = true
+	if err := played.FlushBattery(); err != nil {
+		t.Fatal(err)
+	}
+	if err := played.SaveBattery(); err != nil {
+		t.Fatal(err)
+	}
+	if have, err := os.ReadFile(gb.Cartridge.BatteryPath); err != nil || !bytes.Equal(have, want) {
+		t.Fatalf("want battery save unchanged by the movie, err=%v", err)
+	}
+}
@@ -1,5 +1,10 @@
 package model
 
+import "time"
+
+// 154 lines of 456 dots at 4.194304 MHz
+const FrameDuration = time.Second * 154 * 456 / 4194304
+
 //go:generate go-enum --marshal --flag --values --nocomments
 
 // ENUM(HBlank, VBlank, OAMScan, PixelDraw)
@@ -142,7 +147,6 @@ func (ppu *PPU) SetLY(v Data8) {
 
 func (ppu *PPU) SetLYC(gb *Gameboy, v Data8) {
 	ppu.RegLYC = v
-	gb.IRQCheck()
 }
 
 func (ppu *PPU) SetBGP(v Data8) {
@@ -329,17 +333,22 @@ func (gb *Gameboy) checkHBlankReached() {
 	}
 }
 
+// Hands the viewport to everyone waiting for a frame
+func (ppu *PPU) PublishFrame(fs *FrameSync) {
+	nSyncers := len(fs.Ch)
+	for range nSyncers {
+		f := <-fs.Ch
+		f(&ppu.FBViewport)
+	}
+}
+
 func (ppu *PPU) fsmVBlank(gb *Gameboy, fs *FrameSync) {
 	if ppu.VBlankLineRemainingCycles > 0 {
 		ppu.VBlankLineRemainingCycles--
 		return
 	}
 
-	nSyncers := len(fs.Ch)
-	for range nSyncers {
-		f := <-fs.Ch
-		f(&ppu.FBViewport)
-	}
+	ppu.PublishFrame(fs)
 	ppu.IncRegLY(gb)
 
 	if ppu.RegLY == 0 {
@@ -21,7 +21,7 @@ func (gb *Gameboy) fsmPPUDMA() {
 
 	// Write next data
 	// TODO: presumably this is not actually how it works
-	gb.Mem[d.Dest] = gb.Mem[d.Source]
+	gb.Mem[d.Dest] = gb.ProbeAddress(d.Source)
 
 	if d.Dest == AddrOAMEnd {
 		// Done
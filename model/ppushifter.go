@@ -20,7 +20,7 @@ func (gb *Gameboy) shifterFSM(clk *ClockRT) {
 		return
 	}
 	gb.writePixelToLCD(pixel)
-	gb.Debug.SetX(ps.X, clk)
+	gb.Debug.SetX(gb, ps.X, clk)
 }
 
 func (gb *Gameboy) shiftDiscarded() {
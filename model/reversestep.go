@@ -0,0 +1,121 @@
+package model
+
+import "sort"
+
+// Reverse debugging: restore a snapshot from before the current cycle and re-execute from there,
+// replaying the recorded joypad input, up to the point of interest.
+// Like the rest of Snapshots, these must be called from the clock's goroutine.
+
+// Steps back to right after the previous instruction fetch, i.e. where a forward breakpoint would have stopped.
+// Returns false and stops at the oldest snapshot if there is no earlier instruction in the history.
+func (s *Snapshots) StepBackInstruction(gb *Gameboy, clk *ClockRT) (bool, error) {
+	return s.reverseTo(gb, clk, func(fetched, hit bool) bool {
+		return fetched
+	})
+}
+
+// Runs backwards to the previous breakpoint hit.
+// Returns false and stops at the oldest snapshot if no breakpoint was hit within the history.
+func (s *Snapshots) ReverseContinue(gb *Gameboy, clk *ClockRT) (bool, error) {
+	return s.reverseTo(gb, clk, func(fetched, hit bool) bool {
+		return hit
+	})
+}
+
+// Finds the last M-cycle before the current one where match returns true, and stops after it
+func (s *Snapshots) reverseTo(gb *Gameboy, clk *ClockRT, match func(fetched, hit bool) bool) (bool, error) {
+	if !s.hasLatest {
+		return false, nil
+	}
+
+	// Instructions after the point we stop at are removed from the execution log
+	fetches := gb.Debug.Fetches
+	defer func() {
+		if gb.Debug.Fetches < fetches {
+			gb.CPU.Rewind.Unfetch(fetches - gb.Debug.Fetches)
+		}
+	}()
+
+	from := clk.Cycle
+	limit := from
+	for {
+		// Search the span between the newest snapshot before the limit and the limit
+		if limit > 0 {
+			limit--
+		}
+		if err := s.restore(gb, clk, limit); err != nil {
+			return false, err
+		}
+		start := clk.Cycle
+		if start > limit {
+			// Went past the oldest snapshot without finding anything
+			s.dropInputsAfter(clk.Cycle)
+			return false, nil
+		}
+
+		found := false
+		var target uint
+		s.replay(gb, clk, limit+1, func(cycle uint, fetched, hit bool) {
+			if cycle < from && match(fetched, hit) {
+				found = true
+				target = cycle
+			}
+		})
+		if found {
+			if err := s.restore(gb, clk, target); err != nil {
+				return false, err
+			}
+			s.replay(gb, clk, target, func(cycle uint, fetched, hit bool) {})
+			s.dropInputsAfter(clk.Cycle)
+			return true, nil
+		}
+		if start == 0 {
+			// Nothing before the oldest snapshot either, the replay went past it
+			if err := s.restore(gb, clk, 0); err != nil {
+				return false, err
+			}
+			s.dropInputsAfter(clk.Cycle)
+			return false, nil
+		}
+		limit = start
+	}
+}
+
+// Runs from the current state up to the target cycle, applying the recorded input at the cycles it was applied at.
+// This runs on a separate clock without listeners, queued input or a link cable, and with the debugger quiet,
+// so the re-execution is only visible through the Gameboy. The link cable reads as disconnected.
+// Breakpoints don't pause the clock, instead visit is told about them after each M-cycle.
+func (s *Snapshots) replay(gb *Gameboy, clk *ClockRT, target uint, visit func(cycle uint, fetched, hit bool)) {
+	rc := &ClockRT{
+		Cycle:      clk.Cycle,
+		frameCount: clk.frameCount,
+		rumbleOn:   clk.rumbleOn,
+		serialPeer: SerialDisconnected{},
+		replaying:  true,
+		Onpanic:    clk.Onpanic,
+	}
+	audio := AudioSilent{}
+	fs := &FrameSync{}
+	for {
+		i := sort.Search(len(s.inputs), func(i int) bool {
+			return s.inputs[i].Cycle >= rc.Cycle
+		})
+		for ; i < len(s.inputs) && s.inputs[i].Cycle == rc.Cycle; i++ {
+			gb.Joypad.Apply(gb, s.inputs[i].State)
+		}
+		if rc.Cycle >= target {
+			break
+		}
+
+		fetches := gb.Debug.Fetches
+		rc.MCycle(1, gb, audio, fs)
+		hit := rc.PauseAfterCycle.Swap(0) > 0
+		visit(rc.Cycle, gb.Debug.Fetches != fetches, hit)
+	}
+	clk.Cycle = rc.Cycle
+	clk.frameCount = rc.frameCount
+
+	// As if the clock had stopped right before the next M-cycle
+	gb.TCycle = clk.Cycle
+	gb.MCycle = clk.Cycle >> 2
+}
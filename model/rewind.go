@@ -68,3 +68,28 @@ func (rb *Rewind) Push() *ExecLogEntry {
 	}
 	return &rb.Buffer[idx]
 }
+
+// Removes the newest n instruction fetches, e.g. after execution has been rewound.
+// NOPs that were merged into one entry are removed one at a time.
+func (rb *Rewind) Unfetch(n uint) {
+	var entries []ExecLogEntry
+	for i := rb.Start(); i != rb.End(); i = rb.Next(i) {
+		entries = append(entries, rb.Buffer[i])
+	}
+	for ; n > 0 && len(entries) > 0; n-- {
+		last := &entries[len(entries)-1]
+		if last.Instruction.Opcode == OpcodeNop && last.Instruction.NopCount > 0 {
+			last.Instruction.NopCount--
+		} else {
+			entries = entries[:len(entries)-1]
+		}
+	}
+
+	rb.Reset()
+	copy(rb.Buffer, entries)
+	rb.Idx = len(entries)
+	if rb.Idx > 0 {
+		// Not known until the next fetch
+		rb.Buffer[rb.Idx-1].BranchResult = 0
+	}
+}
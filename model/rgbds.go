@@ -0,0 +1,340 @@
+package model
+
+import (
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Where the CPU starts executing without being led there by other code: the entry point, RST vectors and interrupt vectors
+var romEntryPoints = []Addr{0x0100, 0x00, 0x08, 0x10, 0x18, 0x20, 0x28, 0x30, 0x38, 0x40, 0x48, 0x50, 0x58, 0x60}
+
+// Disassembles each bank of a ROM, exploring from romEntryPoints with the bank mapped in at $4000.
+// The first element covers bank 0 at $0000-$3FFF, the others bank N at $4000-$7FFF.
+// Bank 0 code found with any bank mapped in is included.
+func DisassembleROM(rom []Data8) []*Disassembly {
+	nBanks := max(len(rom)/ROMBankSize, 2)
+	bank0 := make([]DisInstruction, ROMBankSize)
+	banks := []*Disassembly{nil}
+	for bank := 1; bank < nBanks; bank++ {
+		source := make([]Data8, 2*ROMBankSize)
+		copy(source, rom[:min(len(rom), ROMBankSize)])
+		if len(rom) > bank*ROMBankSize {
+			copy(source[ROMBankSize:], rom[bank*ROMBankSize:])
+		}
+		dis := NewDisassembler(&ConfigDisassembler{Enable: true})
+		dis.SetProgram(source)
+		for _, addr := range romEntryPoints {
+			dis.ExploreFrom(addr)
+		}
+
+		// Instructions crossing into the banked area are left as data in both banks
+		decoded := dis.Program.Decoded
+		for addr := Addr(0); addr < ROMBankSize; addr++ {
+			di := decoded[addr]
+			end := int(di.Address) + int(di.Size())
+			if di.Size() == 0 || di.Address != addr || end > ROMBankSize || slices.ContainsFunc(bank0[addr:end], isDecoded) {
+				continue
+			}
+			for i := addr; int(i) < end; i++ {
+				bank0[i] = di
+			}
+		}
+		bankN := slices.Clone(decoded[ROMBankSize:])
+		for i := range bankN {
+			if bankN[i].Address < ROMBankSize {
+				bankN[i] = DisInstruction{}
+			}
+		}
+		banks = append(banks, disassemblyOf(source[ROMBankSize:], ROMBankSize, bankN))
+	}
+	banks[0] = disassemblyOf(rom[:min(len(rom), ROMBankSize)], 0, bank0)
+	return banks
+}
+
+func isDecoded(di DisInstruction) bool {
+	return di.Size() > 0
+}
+
+func disassemblyOf(source []Data8, begin Addr, decoded []DisInstruction) *Disassembly {
+	dis := Disassembler{
+		Enabled: true,
+		Program: Block{Name: "Program", Begin: begin, Source: source, Decoded: decoded},
+	}
+	return dis.Disassembly(begin, begin+Addr(len(source)))
+}
+
+// Writes the output of DisassembleROM as RGBDS source which assembles back to the same ROM.
+// Jump and call targets get labels like Jump_000_0150 or Call_001_4000 when they can be reached by name.
+func WriteRGBDS(w io.Writer, banks []*Disassembly) error {
+	labels := rgbdsLabels(banks)
+	for bank, dis := range banks {
+		if bank == 0 {
+			fmt.Fprintf(w, "SECTION \"ROM Bank $000\", ROM0[$0000]\n")
+		} else {
+			fmt.Fprintf(w, "\nSECTION \"ROM Bank $%03x\", ROMX[$4000], BANK[$%03x]\n", bank, bank)
+		}
+		data := splitSections(dis.Data)
+		iCode, iData := 0, 0
+		for iCode < len(dis.Code) || iData < len(data) {
+			if iData == len(data) || (iCode < len(dis.Code) && dis.Code[iCode].Address() < data[iData].Address) {
+				for _, di := range dis.Code[iCode].Instructions {
+					writeRGBDSLabel(w, labels[bank][di.Address])
+					fmt.Fprintf(w, "    %s\n", rgbdsAsm(di, rgbdsTarget(labels, bank, di)))
+				}
+				iCode++
+			} else {
+				writeRGBDSData(w, labels[bank], &data[iData])
+				iData++
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n")
+	return err
+}
+
+func writeRGBDSLabel(w io.Writer, label string) {
+	if label != "" {
+		fmt.Fprintf(w, "\n%s:\n", label)
+	}
+}
+
+// Writes the data as db lines, or ds for runs of the same byte, split at labels
+func writeRGBDSData(w io.Writer, labels map[Addr]string, section *DataSection) {
+	for start := 0; start < len(section.Raw); {
+		end := start + 1
+		for end < len(section.Raw) && labels[section.Address+Addr(end)] == "" {
+			end++
+		}
+		writeRGBDSLabel(w, labels[section.Address+Addr(start)])
+		raw := section.Raw[start:end]
+		if len(raw) >= 32 && !slices.ContainsFunc(raw, func(b Data8) bool { return b != raw[0] }) {
+			fmt.Fprintf(w, "    ds %d, $%s\n", len(raw), raw[0].Hex())
+		} else {
+			for line := range slices.Chunk(raw, 16) {
+				fmt.Fprintf(w, "    db ")
+				for i, b := range line {
+					if i > 0 {
+						fmt.Fprintf(w, ", ")
+					}
+					fmt.Fprintf(w, "$%s", b.Hex())
+				}
+				fmt.Fprintf(w, "\n")
+			}
+		}
+		start = end
+	}
+}
+
+// Jump or call target of the instruction, if it has one
+func rgbdsJump(di DisInstruction) (Addr, bool, bool) {
+	switch di.Opcode {
+	case OpcodeCALLnn, OpcodeCALLZnn, OpcodeCALLNZnn, OpcodeCALLCnn, OpcodeCALLNCnn:
+		return Addr(join16(di.Raw[2], di.Raw[1])), true, true
+	case OpcodeJPnn, OpcodeJPZnn, OpcodeJPNZnn, OpcodeJPCnn, OpcodeJPNCnn:
+		return Addr(join16(di.Raw[2], di.Raw[1])), false, true
+	case OpcodeJRe, OpcodeJRZe, OpcodeJRNZe, OpcodeJRCe, OpcodeJRNCe:
+		return di.Address + 2 + Addr(int8(di.Raw[1])), false, true
+	}
+	return 0, false, false
+}
+
+// Bank of the section a label for the target would be in, when seen from code in the given bank
+func rgbdsTargetBank(bank int, target Addr) (int, bool) {
+	switch {
+	case target < ROMBankSize:
+		return 0, true
+	case target < 2*ROMBankSize && bank > 0:
+		return bank, true
+	}
+	return 0, false
+}
+
+// Label names for jump and call targets in each bank, except those inside instructions
+func rgbdsLabels(banks []*Disassembly) []map[Addr]string {
+	labels := make([]map[Addr]string, len(banks))
+	inside := make([]map[Addr]bool, len(banks))
+	for bank, dis := range banks {
+		labels[bank] = map[Addr]string{}
+		inside[bank] = map[Addr]bool{}
+		for _, section := range dis.Code {
+			for _, di := range section.Instructions {
+				for i := Addr(1); i < Addr(di.Size()); i++ {
+					inside[bank][di.Address+i] = true
+				}
+			}
+		}
+	}
+	for bank, dis := range banks {
+		for _, section := range dis.Code {
+			for _, di := range section.Instructions {
+				target, call, ok := rgbdsJump(di)
+				if !ok {
+					continue
+				}
+				targetBank, ok := rgbdsTargetBank(bank, target)
+				if !ok || inside[targetBank][target] {
+					continue
+				}
+				kind := "Jump"
+				if call {
+					kind = "Call"
+				}
+				if prev := labels[targetBank][target]; prev == "" || kind == "Call" {
+					labels[targetBank][target] = fmt.Sprintf("%s_%03x_%s", kind, targetBank, target.Hex())
+				}
+			}
+		}
+	}
+	return labels
+}
+
+// Label or address for the jump or call target
+func rgbdsTarget(labels []map[Addr]string, bank int, di DisInstruction) string {
+	target, _, ok := rgbdsJump(di)
+	if !ok {
+		return ""
+	}
+	if targetBank, ok := rgbdsTargetBank(bank, target); ok {
+		if label := labels[targetBank][target]; label != "" {
+			return label
+		}
+	}
+	return "$" + target.Hex()
+}
+
+var (
+	rgbdsR   = [8]string{"b", "c", "d", "e", "h", "l", "[hl]", "a"}
+	rgbdsRP  = [4]string{"bc", "de", "hl", "sp"}
+	rgbdsRP2 = [4]string{"bc", "de", "hl", "af"}
+	rgbdsCC  = [4]string{"nz", "z", "nc", "c"}
+	rgbdsALU = [8]string{"add", "adc", "sub", "sbc", "and", "xor", "or", "cp"}
+	rgbdsRot = [8]string{"rlc", "rrc", "rl", "rr", "sla", "sra", "swap", "srl"}
+)
+
+// Instruction in RGBDS syntax, with target in place of the jump or call address.
+// Decoded from the opcode's bit fields (x=7-6, y=5-3, z=2-0) rather than the Opcode names.
+func rgbdsAsm(di DisInstruction, target string) string {
+	op := di.Raw[0]
+	x, y, z := op>>6, (op>>3)&7, op&7
+	p, q := y>>1, y&1
+	n := "$" + di.Raw[1].Hex()
+	nn := "$" + join16(di.Raw[2], di.Raw[1]).Hex()
+	e := int8(di.Raw[1])
+	switch x {
+	case 0:
+		switch z {
+		case 0:
+			switch y {
+			case 0:
+				return "nop"
+			case 1:
+				return fmt.Sprintf("ld [%s], sp", nn)
+			case 2:
+				// rgbasm always adds a byte after STOP, which the ROM might not have
+				return "db $10 ; stop"
+			case 3:
+				return "jr " + target
+			default:
+				return fmt.Sprintf("jr %s, %s", rgbdsCC[y-4], target)
+			}
+		case 1:
+			if q == 0 {
+				return fmt.Sprintf("ld %s, %s", rgbdsRP[p], nn)
+			}
+			return fmt.Sprintf("add hl, %s", rgbdsRP[p])
+		case 2:
+			mem := [4]string{"[bc]", "[de]", "[hl+]", "[hl-]"}[p]
+			if q == 0 {
+				return fmt.Sprintf("ld %s, a", mem)
+			}
+			return fmt.Sprintf("ld a, %s", mem)
+		case 3:
+			if q == 0 {
+				return "inc " + rgbdsRP[p]
+			}
+			return "dec " + rgbdsRP[p]
+		case 4:
+			return "inc " + rgbdsR[y]
+		case 5:
+			return "dec " + rgbdsR[y]
+		case 6:
+			return fmt.Sprintf("ld %s, %s", rgbdsR[y], n)
+		case 7:
+			return [8]string{"rlca", "rrca", "rla", "rra", "daa", "cpl", "scf", "ccf"}[y]
+		}
+	case 1:
+		if y == 6 && z == 6 {
+			return "halt"
+		}
+		return fmt.Sprintf("ld %s, %s", rgbdsR[y], rgbdsR[z])
+	case 2:
+		return fmt.Sprintf("%s a, %s", rgbdsALU[y], rgbdsR[z])
+	case 3:
+		switch z {
+		case 0:
+			switch y {
+			case 4:
+				return fmt.Sprintf("ldh [$ff%s], a", di.Raw[1].Hex())
+			case 5:
+				return fmt.Sprintf("add sp, %d", e)
+			case 6:
+				return fmt.Sprintf("ldh a, [$ff%s]", di.Raw[1].Hex())
+			case 7:
+				return fmt.Sprintf("ld hl, sp%+d", e)
+			default:
+				return "ret " + rgbdsCC[y]
+			}
+		case 1:
+			if q == 0 {
+				return "pop " + rgbdsRP2[p]
+			}
+			return [4]string{"ret", "reti", "jp hl", "ld sp, hl"}[p]
+		case 2:
+			switch y {
+			case 4:
+				return "ldh [c], a"
+			case 5:
+				return fmt.Sprintf("ld [%s], a", nn)
+			case 6:
+				return "ldh a, [c]"
+			case 7:
+				return fmt.Sprintf("ld a, [%s]", nn)
+			default:
+				return fmt.Sprintf("jp %s, %s", rgbdsCC[y], target)
+			}
+		case 3:
+			switch y {
+			case 0:
+				return "jp " + target
+			case 1:
+				cb := di.Raw[1]
+				cx, cy, cz := cb>>6, (cb>>3)&7, cb&7
+				if cx == 0 {
+					return fmt.Sprintf("%s %s", rgbdsRot[cy], rgbdsR[cz])
+				}
+				return fmt.Sprintf("%s %d, %s", [4]string{"", "bit", "res", "set"}[cx], cy, rgbdsR[cz])
+			case 6:
+				return "di"
+			case 7:
+				return "ei"
+			}
+		case 4:
+			if y < 4 {
+				return fmt.Sprintf("call %s, %s", rgbdsCC[y], target)
+			}
+		case 5:
+			if q == 0 {
+				return "push " + rgbdsRP2[p]
+			}
+			if p == 0 {
+				return "call " + target
+			}
+		case 6:
+			return fmt.Sprintf("%s a, %s", rgbdsALU[y], n)
+		case 7:
+			return fmt.Sprintf("rst $%s", Data8(y*8).Hex())
+		}
+	}
+	return fmt.Sprintf("db $%s", op.Hex())
+}
@@ -0,0 +1,154 @@
+package model
+
+// The RTC is driven by its own 32768 Hz crystal on real hardware.
+// Here it is derived from the emulated clock instead, so that save states and fast-forward stay consistent.
+const RTCCyclesPerSecond = 4194304
+
+const (
+	RTCRegS = iota
+	RTCRegM
+	RTCRegH
+	RTCRegDL
+	RTCRegDH
+	NRTCRegs
+)
+
+// Values written to 0x4000-0x5fff to map an RTC register into 0xa000-0xbfff
+const (
+	RTCSelectBegin = 0x08
+	RTCSelectEnd   = 0x0c
+)
+
+const (
+	RTCDHDayMSB = Bit0
+	RTCDHHalt   = Bit6
+	RTCDHCarry  = Bit7
+)
+
+var rtcRegMasks = [NRTCRegs]Data8{0x3f, 0x3f, 0x1f, 0xff, RTCDHDayMSB | RTCDHHalt | RTCDHCarry}
+
+type RTC struct {
+	Live    [NRTCRegs]Data8
+	Latched [NRTCRegs]Data8
+	Cycles  uint
+}
+
+func (rtc *RTC) Halted() bool {
+	return rtc.Live[RTCRegDH]&RTCDHHalt != 0
+}
+
+func (rtc *RTC) Days() Data16 {
+	return join16(rtc.Live[RTCRegDH]&RTCDHDayMSB, rtc.Live[RTCRegDL])
+}
+
+func (rtc *RTC) setDays(days Data16) {
+	rtc.Live[RTCRegDL] = days.LSB()
+	rtc.Live[RTCRegDH] = maskedWrite(rtc.Live[RTCRegDH], days.MSB(), RTCDHDayMSB)
+}
+
+// Copy the live registers to the latched registers, which are the ones visible to the CPU
+func (rtc *RTC) Latch() {
+	rtc.Latched = rtc.Live
+}
+
+func (rtc *RTC) Read(sel Data8) Data8 {
+	if sel < RTCSelectBegin || sel > RTCSelectEnd {
+		return 0xff
+	}
+	return rtc.Latched[sel-RTCSelectBegin]
+}
+
+func (rtc *RTC) Write(sel Data8, v Data8) {
+	if sel < RTCSelectBegin || sel > RTCSelectEnd {
+		return
+	}
+	reg := sel - RTCSelectBegin
+	v &= rtcRegMasks[reg]
+	rtc.Live[reg] = v
+	rtc.Latched[reg] = v
+
+	// Writing the seconds register resets the sub-second divider
+	if reg == RTCRegS {
+		rtc.Cycles = 0
+	}
+}
+
+// Clock the RTC by one M-cycle
+func (rtc *RTC) clock() {
+	if rtc.Halted() {
+		return
+	}
+	rtc.Cycles += 4
+	if rtc.Cycles >= RTCCyclesPerSecond {
+		rtc.Cycles -= RTCCyclesPerSecond
+		rtc.tick()
+	}
+}
+
+// Advance the RTC by one second.
+// Out-of-range values (e.g. seconds=62) keep counting until the register overflows, without carrying.
+func (rtc *RTC) tick() {
+	s := (rtc.Live[RTCRegS] + 1) & rtcRegMasks[RTCRegS]
+	if s != 60 {
+		rtc.Live[RTCRegS] = s
+		return
+	}
+	rtc.Live[RTCRegS] = 0
+
+	m := (rtc.Live[RTCRegM] + 1) & rtcRegMasks[RTCRegM]
+	if m != 60 {
+		rtc.Live[RTCRegM] = m
+		return
+	}
+	rtc.Live[RTCRegM] = 0
+
+	h := (rtc.Live[RTCRegH] + 1) & rtcRegMasks[RTCRegH]
+	if h != 24 {
+		rtc.Live[RTCRegH] = h
+		return
+	}
+	rtc.Live[RTCRegH] = 0
+
+	days := rtc.Days() + 1
+	if days > 0x1ff {
+		days = 0
+		rtc.Live[RTCRegDH] |= RTCDHCarry
+	}
+	rtc.setDays(days)
+}
+
+// Advance the RTC by a number of seconds, e.g. the time that has passed while the emulator was closed
+func (rtc *RTC) Advance(seconds uint64) {
+	if rtc.Halted() {
+		return
+	}
+
+	// Out-of-range values don't carry normally, so step through those one second at a time
+	for seconds > 0 && !rtc.inRange() {
+		rtc.tick()
+		seconds--
+	}
+	if seconds == 0 {
+		return
+	}
+
+	total := uint64(rtc.Live[RTCRegS]) +
+		60*uint64(rtc.Live[RTCRegM]) +
+		3600*uint64(rtc.Live[RTCRegH]) +
+		86400*uint64(rtc.Days()) +
+		seconds
+	rtc.Live[RTCRegS] = Data8(total % 60)
+	total /= 60
+	rtc.Live[RTCRegM] = Data8(total % 60)
+	total /= 60
+	rtc.Live[RTCRegH] = Data8(total % 24)
+	total /= 24
+	if total > 0x1ff {
+		rtc.Live[RTCRegDH] |= RTCDHCarry
+	}
+	rtc.setDays(Data16(total & 0x1ff))
+}
+
+func (rtc *RTC) inRange() bool {
+	return rtc.Live[RTCRegS] < 60 && rtc.Live[RTCRegM] < 60 && rtc.Live[RTCRegH] < 24
+}
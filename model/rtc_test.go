@@ -0,0 +1,135 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/jonathangjertsen/toyboy/model"
+)
+
+func setRTC(rtc *model.RTC, days int, h, m, s model.Data8) {
+	rtc.Write(model.RTCSelectBegin+model.RTCRegS, s)
+	rtc.Write(model.RTCSelectBegin+model.RTCRegM, m)
+	rtc.Write(model.RTCSelectBegin+model.RTCRegH, h)
+	rtc.Write(model.RTCSelectBegin+model.RTCRegDL, model.Data8(days))
+	rtc.Write(model.RTCSelectBegin+model.RTCRegDH, model.Data8(days>>8))
+}
+
+func checkRTC(t *testing.T, rtc *model.RTC, days int, h, m, s model.Data8) {
+	t.Helper()
+	if rtc.Days() != model.Data16(days) || rtc.Live[model.RTCRegH] != h || rtc.Live[model.RTCRegM] != m || rtc.Live[model.RTCRegS] != s {
+		t.Fatalf("want %dd %02d:%02d:%02d have %dd %02d:%02d:%02d", days, h, m, s,
+			rtc.Days(), rtc.Live[model.RTCRegH], rtc.Live[model.RTCRegM], rtc.Live[model.RTCRegS])
+	}
+}
+
+func TestRTCClock(t *testing.T) {
+	gb, clk := newCartridgeGameboy(0x10, 0x06, 0x03)
+	audio, devnull := model.AudioStub()
+	defer close(devnull)
+	fs := model.FrameSync{}
+	rtc := &gb.Cartridge.RTC
+
+	// Runs until the next second starts
+	nextSecond := func() {
+		rtc.Cycles = model.RTCCyclesPerSecond - 8
+		clk.MCycle(2, gb, audio, &fs)
+	}
+
+	setRTC(rtc, 0, 0, 0, 0)
+	clk.MCycle(100, gb, audio, &fs)
+	if rtc.Cycles != 400 {
+		t.Fatalf("want RTC clocked once per T-cycle, have %d", rtc.Cycles)
+	}
+	nextSecond()
+	checkRTC(t, rtc, 0, 0, 0, 1)
+
+	setRTC(rtc, 0, 0, 0, 59)
+	nextSecond()
+	checkRTC(t, rtc, 0, 0, 1, 0)
+
+	setRTC(rtc, 0, 0, 59, 59)
+	nextSecond()
+	checkRTC(t, rtc, 0, 1, 0, 0)
+
+	setRTC(rtc, 0xff, 23, 59, 59)
+	nextSecond()
+	checkRTC(t, rtc, 0x100, 0, 0, 0)
+	if rtc.Live[model.RTCRegDH]&model.RTCDHCarry != 0 {
+		t.Fatalf("want no carry")
+	}
+
+	setRTC(rtc, 0x1ff, 23, 59, 59)
+	nextSecond()
+	checkRTC(t, rtc, 0, 0, 0, 0)
+	if rtc.Live[model.RTCRegDH]&model.RTCDHCarry == 0 {
+		t.Fatalf("want day counter carry")
+	}
+	nextSecond()
+	if rtc.Live[model.RTCRegDH]&model.RTCDHCarry == 0 {
+		t.Fatalf("want carry to stay set until cleared")
+	}
+
+	// Out-of-range values count up to the register width without carrying
+	setRTC(rtc, 0, 0, 0, 63)
+	nextSecond()
+	checkRTC(t, rtc, 0, 0, 0, 0)
+
+	// Writing the seconds resets the sub-second divider
+	rtc.Cycles = 1000
+	rtc.Write(model.RTCSelectBegin+model.RTCRegS, 10)
+	if rtc.Cycles != 0 {
+		t.Fatalf("want divider reset, have %d", rtc.Cycles)
+	}
+}
+
+func TestRTCHalt(t *testing.T) {
+	gb, clk := newCartridgeGameboy(0x10, 0x06, 0x03)
+	audio, devnull := model.AudioStub()
+	defer close(devnull)
+	fs := model.FrameSync{}
+	rtc := &gb.Cartridge.RTC
+
+	setRTC(rtc, 0, 0, 0, 59)
+	rtc.Write(model.RTCSelectBegin+model.RTCRegDH, model.RTCDHHalt)
+	rtc.Cycles = model.RTCCyclesPerSecond - 4
+	clk.MCycle(100, gb, audio, &fs)
+	rtc.Advance(1000)
+	if !rtc.Halted() || rtc.Cycles != model.RTCCyclesPerSecond-4 {
+		t.Fatalf("want halted RTC to stand still, have cycles=%d", rtc.Cycles)
+	}
+	checkRTC(t, rtc, 0, 0, 0, 59)
+
+	rtc.Write(model.RTCSelectBegin+model.RTCRegDH, 0)
+	clk.MCycle(1, gb, audio, &fs)
+	checkRTC(t, rtc, 0, 0, 1, 0)
+}
+
+func TestRTCAdvance(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		days    int
+		h, m, s model.Data8
+		seconds uint64
+		want    [4]int
+		carry   bool
+	}{
+		{name: "zero", seconds: 0, want: [4]int{0, 0, 0, 0}},
+		{name: "mixed", seconds: 2*86400 + 3*3600 + 4*60 + 5, want: [4]int{2, 3, 4, 5}},
+		{name: "carry into minutes", s: 50, seconds: 15, want: [4]int{0, 0, 1, 5}},
+		{name: "carry into days", days: 10, h: 23, m: 59, s: 59, seconds: 1, want: [4]int{11, 0, 0, 0}},
+		{name: "day counter overflow", days: 0x1ff, h: 23, m: 59, s: 59, seconds: 2, want: [4]int{0, 0, 0, 1}, carry: true},
+		{name: "long overflow", seconds: 600 * 86400, want: [4]int{600 - 512, 0, 0, 0}, carry: true},
+		// 62 -> 63 -> 0 without carrying, then counts normally
+		{name: "out of range", s: 62, seconds: 3, want: [4]int{0, 0, 0, 1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var rtc model.RTC
+			setRTC(&rtc, tc.days, tc.h, tc.m, tc.s)
+			rtc.Advance(tc.seconds)
+			checkRTC(t, &rtc, tc.want[0], model.Data8(tc.want[1]), model.Data8(tc.want[2]), model.Data8(tc.want[3]))
+			if carry := rtc.Live[model.RTCRegDH]&model.RTCDHCarry != 0; carry != tc.carry {
+				t.Fatalf("want carry=%v have %v", tc.carry, carry)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package model
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Save state file layout:
+//
+//	magic (8 bytes) | version (uint32 LE) | header length (uint32 LE) | header (gob) | state (gzipped gob)
+//
+// The state is the whole Gameboy except for the cartridge ROM, which is identified by the header instead.
+const (
+	SaveStateMagic   = "TOYBOYSS"
+	SaveStateVersion = 1
+)
+
+type SaveStateHeader struct {
+	Version        uint32
+	Title          string
+	HeaderChecksum Data8
+	GlobalChecksum Data16
+	Cycle          uint
+	Timestamp      time.Time
+
+	// PNG of the viewport at the time of saving
+	Thumbnail []byte
+}
+
+// Converts the gob-encoded state from one version to the next.
+// A migration can decode the old layout with a copy of the old types and re-encode it with the new ones.
+type SaveStateMigration func(state []byte) ([]byte, error)
+
+// Migrations by the version they migrate from
+var saveStateMigrations = map[uint32]SaveStateMigration{}
+
+func RegisterSaveStateMigration(from uint32, migrate SaveStateMigration) {
+	saveStateMigrations[from] = migrate
+}
+
+// Path of the save state in the given slot, i.e. "game.gb" => "game.ss<slot>"
+func SaveStatePath(romPath string, slot int) string {
+	return fmt.Sprintf("%s.ss%d", strings.TrimSuffix(romPath, filepath.Ext(romPath)), slot)
+}
+
+func (gb *Gameboy) saveStateHeader(cycle uint, now time.Time) SaveStateHeader {
+	bank0 := &gb.Cartridge.ROM[0]
+	return SaveStateHeader{
+		Version:        SaveStateVersion,
+		Title:          gb.CartridgeTitle(),
+		HeaderChecksum: bank0[AddrHeaderChecksum],
+		GlobalChecksum: join16(bank0[AddrGlobalChecksumBegin], bank0[AddrGlobalChecksumEnd]),
+		Cycle:          cycle,
+		Timestamp:      now,
+	}
+}
+
+// Checks that a state made with the header can be loaded into the currently inserted cartridge
+func (gb *Gameboy) CheckSaveStateHeader(hdr SaveStateHeader) error {
+	have := gb.saveStateHeader(0, time.Time{})
+	if hdr.Title != have.Title || hdr.HeaderChecksum != have.HeaderChecksum || hdr.GlobalChecksum != have.GlobalChecksum {
+		return fmt.Errorf(
+			"save state is for '%s' (checksums %s/%s), but '%s' (checksums %s/%s) is loaded",
+			hdr.Title, hdr.HeaderChecksum.Hex(), hdr.GlobalChecksum.Hex(),
+			have.Title, have.HeaderChecksum.Hex(), have.GlobalChecksum.Hex(),
+		)
+	}
+	return nil
+}
+
+func (gb *Gameboy) EncodeSaveState(w io.Writer, cycle uint, now time.Time) error {
+	hdr := gb.saveStateHeader(cycle, now)
+	var thumbnail bytes.Buffer
+	if err := gb.PPU.FBViewport.EncodePNG(&thumbnail, RGBA); err != nil {
+		return fmt.Errorf("encoding thumbnail: %w", err)
+	}
+	hdr.Thumbnail = thumbnail.Bytes()
+
+	var hdrBuf bytes.Buffer
+	if err := gob.NewEncoder(&hdrBuf).Encode(hdr); err != nil {
+		return fmt.Errorf("encoding save state header: %w", err)
+	}
+
+	var prefix [16]byte
+	copy(prefix[:8], SaveStateMagic)
+	binary.LittleEndian.PutUint32(prefix[8:], SaveStateVersion)
+	binary.LittleEndian.PutUint32(prefix[12:], uint32(hdrBuf.Len()))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(hdrBuf.Bytes()); err != nil {
+		return err
+	}
+
+	// The ROM is large and can't change, so leave it out, along with its symbols
+	state := *gb
+	state.Cartridge.ROM = nil
+	state.Debug.Symbols = Symbols{}
+
+	gz := gzip.NewWriter(w)
+	if err := gob.NewEncoder(gz).Encode(&state); err != nil {
+		return fmt.Errorf("encoding save state: %w", err)
+	}
+	return gz.Close()
+}
+
+// Reads only the header, e.g. to show the thumbnail of a slot
+func DecodeSaveStateHeader(r io.Reader) (SaveStateHeader, error) {
+	var hdr SaveStateHeader
+	var prefix [16]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return hdr, fmt.Errorf("reading save state: %w", err)
+	}
+	if string(prefix[:8]) != SaveStateMagic {
+		return hdr, fmt.Errorf("not a save state")
+	}
+	version := binary.LittleEndian.Uint32(prefix[8:])
+	if version > SaveStateVersion {
+		return hdr, fmt.Errorf("save state version %d is newer than supported version %d", version, SaveStateVersion)
+	}
+	hdrLen := binary.LittleEndian.Uint32(prefix[12:])
+	if err := gob.NewDecoder(io.LimitReader(r, int64(hdrLen))).Decode(&hdr); err != nil {
+		return hdr, fmt.Errorf("decoding save state header: %w", err)
+	}
+	hdr.Version = version
+	return hdr, nil
+}
+
+// Replaces the state of the Gameboy with a save state, which must have been made with the same cartridge
+func (gb *Gameboy) DecodeSaveState(r io.Reader) (SaveStateHeader, error) {
+	hdr, err := DecodeSaveStateHeader(r)
+	if err != nil {
+		return hdr, err
+	}
+	if err := gb.CheckSaveStateHeader(hdr); err != nil {
+		return hdr, err
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return hdr, fmt.Errorf("reading save state: %w", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		return hdr, fmt.Errorf("reading save state: %w", err)
+	}
+	for v := hdr.Version; v < SaveStateVersion; v++ {
+		migrate, ok := saveStateMigrations[v]
+		if !ok {
+			return hdr, fmt.Errorf("no migration from save state version %d", v)
+		}
+		if data, err = migrate(data); err != nil {
+			return hdr, fmt.Errorf("migrating save state from version %d: %w", v, err)
+		}
+	}
+
+	var state Gameboy
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		return hdr, fmt.Errorf("decoding save state: %w", err)
+	}
+	// Breakpoints, watchpoints and symbols belong to the debugging session rather than the state,
+	// but the call stack belongs to the execution being restored.
+	// The battery save also belongs to this session, the state may have been saved on another machine.
+	state.Cartridge.ROM = gb.Cartridge.ROM
+	state.Cartridge.BatteryPath = gb.Cartridge.BatteryPath
+	calls := state.Debug.Calls
+	state.Debug = gb.Debug
+	state.Debug.Calls = calls
+	*gb = state
+	gb.linkDebugViews()
+	return hdr, nil
+}
+
+// Writes a save state to path. Must be called from the clock's goroutine.
+func (gb *Gameboy) SaveState(path string, clk *ClockRT) error {
+	var buf bytes.Buffer
+	if err := gb.EncodeSaveState(&buf, clk.Cycle, time.Now()); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o666); err != nil {
+		return fmt.Errorf("writing save state: %w", err)
+	}
+	return nil
+}
+
+// Loads a save state from path. Must be called from the clock's goroutine.
+func (gb *Gameboy) LoadState(path string, clk *ClockRT) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening save state: %w", err)
+	}
+	defer f.Close()
+	hdr, err := gb.DecodeSaveState(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	clk.Cycle = hdr.Cycle
+	clk.frameCount = gb.PPU.FrameCount
+	return nil
+}
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Convert the viewport to an image, with each of the 4 shades mapped to a color in the palette
+func (vp *ViewPort) Image(palette [4]color.RGBA) *image.Paletted {
+	pal := make(color.Palette, len(palette))
+	for i, c := range palette {
+		pal[i] = c
+	}
+	img := image.NewPaletted(image.Rect(0, 0, 160, 144), pal)
+	for y := range 144 {
+		for x := range 160 {
+			img.Pix[y*img.Stride+x] = uint8(vp[y][x])
+		}
+	}
+	return img
+}
+
+func (vp *ViewPort) EncodePNG(w io.Writer, palette [4]color.RGBA) error {
+	return png.Encode(w, vp.Image(palette))
+}
+
+func (vp *ViewPort) SavePNG(path string, palette [4]color.RGBA) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating screenshot: %w", err)
+	}
+	if err := vp.EncodePNG(f, palette); err != nil {
+		f.Close()
+		return fmt.Errorf("encoding screenshot: %w", err)
+	}
+	return f.Close()
+}
+
+// Writes completed frames to PNG files in Dir.
+// Attach OnFrame to the clock with ClockRT.AttachFrameListener.
+type FrameDump struct {
+	Dir     string
+	Palette [4]color.RGBA
+
+	// Dump every Nth frame (0 = disabled)
+	Every uint
+
+	// Dump these specific frame numbers
+	Frames []uint
+
+	// First error that occurred while dumping, if any
+	Err error
+}
+
+func FrameDumpPath(dir string, frame uint) string {
+	return filepath.Join(dir, fmt.Sprintf("frame_%06d.png", frame))
+}
+
+func (fd *FrameDump) wants(frame uint) bool {
+	if fd.Every > 0 && frame%fd.Every == 0 {
+		return true
+	}
+	for _, f := range fd.Frames {
+		if f == frame {
+			return true
+		}
+	}
+	return false
+}
+
+func (fd *FrameDump) OnFrame(frame uint, vp *ViewPort) {
+	if fd.Err != nil || !fd.wants(frame) {
+		return
+	}
+	fd.Err = vp.SavePNG(FrameDumpPath(fd.Dir, frame), fd.Palette)
+}
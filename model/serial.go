@@ -0,0 +1,171 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The internal serial clock runs at 8192 Hz, i.e. one bit every 128 M-cycles
+const (
+	SerialMCyclesPerBit  = 128
+	SerialMCyclesPerByte = 8 * SerialMCyclesPerBit
+)
+
+const (
+	SCTransferEnable = Bit7
+	SCClockSelect    = Bit0
+)
+
+// Bits 1-6 of SC are unused and read as 1
+const scUnusedBits Data8 = 0x7e
+
+type Serial struct {
+	// With the internal clock: M-cycles until the ongoing transfer completes.
+	// With the external clock: M-cycles until the peer is polled again.
+	Countdown int
+
+	// When set, every byte sent with the internal clock is appended to Output.
+	// Test ROMs use this to print their results.
+	Capture bool
+	Output  []Data8
+}
+
+// The other end of the link cable
+type SerialPeer interface {
+	// Start exchanging a byte with the peer, with this side providing the clock
+	Send(out Data8)
+
+	// The byte shifted in from the peer for the last Send, once it is available.
+	// Must not block, the transfer is held open until ok is true.
+	Receive() (in Data8, ok bool)
+
+	// Check whether the peer has clocked a byte over to this side.
+	// If so, reply is shifted out to the peer and the received byte is returned.
+	Poll(reply Data8) (in Data8, ok bool)
+}
+
+// No cable connected, the input line is pulled high
+type SerialDisconnected struct{}
+
+func (SerialDisconnected) Send(out Data8) {}
+
+func (SerialDisconnected) Receive() (Data8, bool) {
+	return 0xff, true
+}
+
+func (SerialDisconnected) Poll(reply Data8) (Data8, bool) {
+	return 0, false
+}
+
+// Cable with its output connected to its own input
+type SerialLoopback struct {
+	out Data8
+}
+
+func (s *SerialLoopback) Send(out Data8) {
+	s.out = out
+}
+
+func (s *SerialLoopback) Receive() (Data8, bool) {
+	return s.out, true
+}
+
+func (*SerialLoopback) Poll(reply Data8) (Data8, bool) {
+	return 0, false
+}
+
+// Creates a SerialPeer from a description:
+// "" or "none" (disconnected), "loopback", "listen:<addr>" or "connect:<addr>" (TCP)
+func NewSerialPeer(spec string) (SerialPeer, error) {
+	kind, addr, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "", "none":
+		return SerialDisconnected{}, nil
+	case "loopback":
+		return &SerialLoopback{}, nil
+	case "listen":
+		peer, err := ListenSerialTCP(addr)
+		if err != nil {
+			return nil, err
+		}
+		return peer, nil
+	case "connect":
+		peer, err := DialSerialTCP(addr)
+		if err != nil {
+			return nil, err
+		}
+		return peer, nil
+	}
+	return nil, fmt.Errorf("unknown link cable '%s'", spec)
+}
+
+// Text sent over the serial port since capture was enabled
+func (gb *Gameboy) SerialOutput() string {
+	return string(ByteSlice(gb.Serial.Output))
+}
+
+func (gb *Gameboy) ClearSerialOutput() {
+	gb.Serial.Output = gb.Serial.Output[:0]
+}
+
+func (gb *Gameboy) ReadSerial(addr Addr) Data8 {
+	if addr == AddrSC {
+		return gb.Mem[AddrSC] | scUnusedBits
+	}
+	return gb.Mem[addr]
+}
+
+func (gb *Gameboy) WriteSerial(addr Addr, v Data8) {
+	if addr == AddrSC && v&SCTransferEnable != 0 {
+		if v&SCClockSelect != 0 {
+			gb.Serial.Countdown = SerialMCyclesPerByte
+			if gb.Serial.Capture {
+				gb.Serial.Output = append(gb.Serial.Output, gb.Mem[AddrSB])
+			}
+		} else {
+			gb.Serial.Countdown = 1
+		}
+	}
+}
+
+// Clock the serial controller by one M-cycle
+func (gb *Gameboy) clockSerial(peer SerialPeer) {
+	sc := gb.Mem[AddrSC]
+	if sc&SCTransferEnable == 0 {
+		return
+	}
+	if sc&SCClockSelect != 0 {
+		if gb.Serial.Countdown == SerialMCyclesPerByte {
+			peer.Send(gb.Mem[AddrSB])
+		}
+		gb.Serial.Countdown--
+		if gb.Serial.Countdown > 0 {
+			return
+		}
+		// A slow peer holds the transfer open rather than stalling the clock
+		in, ok := peer.Receive()
+		if !ok {
+			gb.Serial.Countdown = 1
+			return
+		}
+		gb.completeSerial(in)
+		return
+	}
+
+	gb.Serial.Countdown--
+	if gb.Serial.Countdown > 0 {
+		return
+	}
+
+	// The peer provides the clock, so the transfer completes whenever it decides to send something
+	gb.Serial.Countdown = SerialMCyclesPerBit
+	if in, ok := peer.Poll(gb.Mem[AddrSB]); ok {
+		gb.completeSerial(in)
+	}
+}
+
+func (gb *Gameboy) completeSerial(in Data8) {
+	gb.Mem[AddrSB] = in
+	gb.Mem[AddrSC] &^= SCTransferEnable
+	gb.IRQSet(IntSourceSerial)
+}
@@ -0,0 +1,163 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonathangjertsen/toyboy/model"
+)
+
+func writeBus(gb *model.Gameboy, addr model.Addr, v model.Data8) {
+	gb.WriteAddress(addr)
+	gb.WriteData(v)
+}
+
+func serialIRQ(gb *model.Gameboy) bool {
+	return gb.Mem[model.AddrIF]&model.Bit3 != 0
+}
+
+func serialBusy(gb *model.Gameboy) bool {
+	return gb.Mem[model.AddrSC]&model.SCTransferEnable != 0
+}
+
+// Peer that only answers once released
+type slowSerialPeer struct {
+	sent     []model.Data8
+	released bool
+}
+
+func (p *slowSerialPeer) Send(out model.Data8) {
+	p.sent = append(p.sent, out)
+}
+
+func (p *slowSerialPeer) Receive() (model.Data8, bool) {
+	return 0x99, p.released
+}
+
+func (p *slowSerialPeer) Poll(reply model.Data8) (model.Data8, bool) {
+	return 0, false
+}
+
+func TestSerialInternalClock(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		peer model.SerialPeer
+		want model.Data8
+	}{
+		{name: "disconnected", peer: model.SerialDisconnected{}, want: 0xff},
+		{name: "loopback", peer: &model.SerialLoopback{}, want: 0x42},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gb, clk := newDebuggerGameboy()
+			audio, devnull := model.AudioStub()
+			defer close(devnull)
+			fs := model.FrameSync{}
+			clk.SetSerialPeer(tc.peer)
+			gb.Serial.Capture = true
+
+			writeBus(gb, model.AddrSB, 0x42)
+			writeBus(gb, model.AddrSC, model.SCTransferEnable|model.SCClockSelect)
+			if have := gb.ProbeAddress(model.AddrSC); have != 0xff {
+				t.Fatalf("want SC=$FF during transfer, have %s", have.Hex())
+			}
+			clk.MCycle(model.SerialMCyclesPerByte-1, gb, audio, &fs)
+			if !serialBusy(gb) || serialIRQ(gb) {
+				t.Fatalf("want transfer to take %d M-cycles", model.SerialMCyclesPerByte)
+			}
+			clk.MCycle(1, gb, audio, &fs)
+			if serialBusy(gb) || !serialIRQ(gb) {
+				t.Fatalf("want SC bit 7 cleared and serial IRQ after %d M-cycles", model.SerialMCyclesPerByte)
+			}
+			if have := gb.Mem[model.AddrSB]; have != tc.want {
+				t.Fatalf("want SB=%s have %s", tc.want.Hex(), have.Hex())
+			}
+			if have := gb.ProbeAddress(model.AddrSC); have != 0x7f {
+				t.Fatalf("want SC=$7F after transfer, have %s", have.Hex())
+			}
+			if have := gb.SerialOutput(); have != "B" {
+				t.Fatalf("want captured output 'B', have %q", have)
+			}
+		})
+	}
+}
+
+func TestSerialExternalClock(t *testing.T) {
+	gb, clk := newDebuggerGameboy()
+	audio, devnull := model.AudioStub()
+	defer close(devnull)
+	fs := model.FrameSync{}
+	clk.SetSerialPeer(&model.SerialLoopback{})
+
+	// Without a peer providing the clock, the transfer never completes
+	writeBus(gb, model.AddrSB, 0x42)
+	writeBus(gb, model.AddrSC, model.SCTransferEnable)
+	clk.MCycle(10*model.SerialMCyclesPerByte, gb, audio, &fs)
+	if !serialBusy(gb) || serialIRQ(gb) || gb.Mem[model.AddrSB] != 0x42 {
+		t.Fatalf("want transfer pending")
+	}
+}
+
+func TestSerialSlowPeer(t *testing.T) {
+	gb, clk := newDebuggerGameboy()
+	audio, devnull := model.AudioStub()
+	defer close(devnull)
+	fs := model.FrameSync{}
+	peer := &slowSerialPeer{}
+	clk.SetSerialPeer(peer)
+
+	writeBus(gb, model.AddrSB, 0x42)
+	writeBus(gb, model.AddrSC, model.SCTransferEnable|model.SCClockSelect)
+	clk.MCycle(2*model.SerialMCyclesPerByte, gb, audio, &fs)
+	if len(peer.sent) != 1 || peer.sent[0] != 0x42 {
+		t.Fatalf("want one byte sent at the start of the transfer, have %v", peer.sent)
+	}
+	if !serialBusy(gb) || serialIRQ(gb) {
+		t.Fatalf("want transfer held open until the peer answers")
+	}
+	peer.released = true
+	clk.MCycle(1, gb, audio, &fs)
+	if serialBusy(gb) || !serialIRQ(gb) || gb.Mem[model.AddrSB] != 0x99 {
+		t.Fatalf("want transfer completed once the peer answers, have SB=%s", gb.Mem[model.AddrSB].Hex())
+	}
+}
+
+func TestSerialTCP(t *testing.T) {
+	server, err := model.ListenSerialTCP("localhost:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer server.Close()
+	client, err := model.DialSerialTCP(server.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.Timeout = 5 * time.Second
+
+	audio, devnull := model.AudioStub()
+	defer close(devnull)
+	fs := model.FrameSync{}
+	master, masterClk := newDebuggerGameboy()
+	masterClk.SetSerialPeer(client)
+	slave, slaveClk := newDebuggerGameboy()
+	slaveClk.SetSerialPeer(server)
+
+	writeBus(slave, model.AddrSB, 0x24)
+	writeBus(slave, model.AddrSC, model.SCTransferEnable)
+	writeBus(master, model.AddrSB, 0x42)
+	writeBus(master, model.AddrSC, model.SCTransferEnable|model.SCClockSelect)
+	deadline := time.Now().Add(5 * time.Second)
+	for serialBusy(master) || serialBusy(slave) {
+		if time.Now().After(deadline) {
+			t.Fatalf("transfer did not complete")
+		}
+		masterClk.MCycle(16, master, audio, &fs)
+		slaveClk.MCycle(16, slave, audio, &fs)
+	}
+	if master.Mem[model.AddrSB] != 0x24 || slave.Mem[model.AddrSB] != 0x42 {
+		t.Fatalf("want bytes swapped, have master=%s slave=%s", master.Mem[model.AddrSB].Hex(), slave.Mem[model.AddrSB].Hex())
+	}
+	if !serialIRQ(master) || !serialIRQ(slave) {
+		t.Fatalf("want serial IRQ on both sides")
+	}
+}
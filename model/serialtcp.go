@@ -0,0 +1,161 @@
+package model
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// How long to hold a transfer open waiting for the peer to answer before giving up and reading 0xff, as if disconnected.
+// This also keeps the two emulators roughly in sync, since the side providing the clock waits for the other.
+const SerialTCPTimeout = 100 * time.Millisecond
+
+// Each message is a kind byte followed by a data byte
+const (
+	serialMsgExchange = 'X'
+	serialMsgReply    = 'R'
+)
+
+// Link cable over TCP, e.g. between two toyboy instances on the same machine.
+// One side listens with ListenSerialTCP, the other connects with DialSerialTCP.
+// Until the connection is established, the cable behaves as if disconnected.
+type SerialTCP struct {
+	Timeout time.Duration
+
+	listener  net.Listener
+	mu        sync.Mutex
+	conn      net.Conn
+	exchanges chan Data8
+	replies   chan Data8
+
+	// Only used by the side providing the clock, from the clock goroutine
+	sent     bool
+	deadline time.Time
+}
+
+func newSerialTCP() *SerialTCP {
+	return &SerialTCP{
+		Timeout:   SerialTCPTimeout,
+		exchanges: make(chan Data8, 16),
+		replies:   make(chan Data8, 16),
+	}
+}
+
+// Listens for a single peer on addr (e.g. "localhost:8765") without blocking
+func ListenSerialTCP(addr string) (*SerialTCP, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("link cable: %w", err)
+	}
+	s := newSerialTCP()
+	s.listener = listener
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		s.attach(conn)
+	}()
+	return s, nil
+}
+
+func DialSerialTCP(addr string) (*SerialTCP, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("link cable: %w", err)
+	}
+	s := newSerialTCP()
+	s.attach(conn)
+	return s, nil
+}
+
+// Address being listened on, or nil for the connecting side
+func (s *SerialTCP) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+func (s *SerialTCP) Close() error {
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+func (s *SerialTCP) Send(out Data8) {
+	// Drop replies to earlier exchanges that timed out
+	for len(s.replies) > 0 {
+		<-s.replies
+	}
+	s.sent = s.send(serialMsgExchange, out)
+	s.deadline = time.Now().Add(s.Timeout)
+}
+
+func (s *SerialTCP) Receive() (Data8, bool) {
+	if !s.sent {
+		return 0xff, true
+	}
+	select {
+	case in := <-s.replies:
+		return in, true
+	default:
+	}
+	if time.Now().After(s.deadline) {
+		return 0xff, true
+	}
+	return 0, false
+}
+
+func (s *SerialTCP) Poll(reply Data8) (Data8, bool) {
+	select {
+	case in := <-s.exchanges:
+		s.send(serialMsgReply, reply)
+		return in, true
+	default:
+		return 0, false
+	}
+}
+
+func (s *SerialTCP) attach(conn net.Conn) {
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+	go s.receive(conn)
+}
+
+func (s *SerialTCP) receive(conn net.Conn) {
+	var msg [2]byte
+	for {
+		if _, err := io.ReadFull(conn, msg[:]); err != nil {
+			s.mu.Lock()
+			s.conn = nil
+			s.mu.Unlock()
+			return
+		}
+		switch msg[0] {
+		case serialMsgExchange:
+			s.exchanges <- Data8(msg[1])
+		case serialMsgReply:
+			s.replies <- Data8(msg[1])
+		}
+	}
+}
+
+func (s *SerialTCP) send(kind byte, v Data8) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return false
+	}
+	_, err := s.conn.Write([]byte{kind, byte(v)})
+	return err == nil
+}
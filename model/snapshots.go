@@ -0,0 +1,239 @@
+package model
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// Ring buffer of recent machine states, for stepping emulation backwards.
+//
+// The newest state is kept in full. Each older state is kept as the compressed XOR of itself and the state after it,
+// which is mostly zeros since little changes between frames, so memory use stays bounded by the capacity.
+// Joypad input is recorded alongside, so that execution between snapshots can be replayed exactly.
+// Must only be used from the clock's goroutine.
+type Snapshots struct {
+	// Take a snapshot every Interval frames
+	Interval uint
+
+	latest    []byte
+	hasLatest bool
+	cycle     uint
+
+	// Oldest delta at deltas[start]
+	deltas []snapshotDelta
+	start  int
+	n      int
+
+	// Input since the oldest snapshot, in order
+	inputs []InputEvent
+}
+
+// Joypad state applied at the given cycle
+type InputEvent struct {
+	Cycle uint
+	State JoypadState
+}
+
+type snapshotDelta struct {
+	// Length and clock cycle of the older state
+	Len   int
+	Cycle uint
+	Data  []byte
+}
+
+func NewSnapshots(capacity int, interval uint) *Snapshots {
+	return &Snapshots{
+		Interval: max(interval, 1),
+		deltas:   make([]snapshotDelta, capacity),
+	}
+}
+
+// Number of snapshots that can be restored
+func (s *Snapshots) Len() int {
+	if !s.hasLatest {
+		return 0
+	}
+	return s.n + 1
+}
+
+func (s *Snapshots) Reset() {
+	s.latest = nil
+	s.hasLatest = false
+	s.start = 0
+	s.n = 0
+	s.inputs = nil
+}
+
+// Input listener that records the input for replay
+func (s *Snapshots) RecordInput(ev InputEvent) {
+	s.inputs = append(s.inputs, ev)
+}
+
+// Frame listener that takes a snapshot every Interval frames
+func (s *Snapshots) OnFrame(gb *Gameboy, clk *ClockRT, frame uint) error {
+	if frame%s.Interval != 0 {
+		return nil
+	}
+	return s.Take(gb, clk)
+}
+
+func (s *Snapshots) Take(gb *Gameboy, clk *ClockRT) error {
+	data, err := encodeSnapshot(gb)
+	if err != nil {
+		return err
+	}
+	if s.hasLatest && len(s.deltas) > 0 {
+		delta, err := compressDelta(s.latest, data)
+		if err != nil {
+			return err
+		}
+		if s.n == len(s.deltas) {
+			// Full, drop the oldest along with the input that can no longer be replayed
+			s.start = (s.start + 1) % len(s.deltas)
+			s.n--
+			s.dropInputsBefore(s.deltas[s.start].Cycle)
+		}
+		s.deltas[(s.start+s.n)%len(s.deltas)] = snapshotDelta{Len: len(s.latest), Cycle: s.cycle, Data: delta}
+		s.n++
+	}
+	s.latest = data
+	s.hasLatest = true
+	s.cycle = clk.Cycle
+	return nil
+}
+
+func (s *Snapshots) dropInputsBefore(cycle uint) {
+	i := 0
+	for i < len(s.inputs) && s.inputs[i].Cycle < cycle {
+		i++
+	}
+	s.inputs = s.inputs[i:]
+}
+
+// Forgets input recorded after the cycle, when that future is no longer going to happen
+func (s *Snapshots) dropInputsAfter(cycle uint) {
+	for len(s.inputs) > 0 && s.inputs[len(s.inputs)-1].Cycle > cycle {
+		s.inputs = s.inputs[:len(s.inputs)-1]
+	}
+}
+
+// Restores the state before the newest snapshot and discards the newest one.
+// When only one snapshot is left, it is restored and kept. Returns false if there are no snapshots.
+func (s *Snapshots) StepBack(gb *Gameboy, clk *ClockRT) (bool, error) {
+	if !s.hasLatest {
+		return false, nil
+	}
+	if s.n > 0 {
+		if err := s.pop(); err != nil {
+			return false, err
+		}
+	}
+	fetches := gb.Debug.Fetches
+	if err := s.restoreLatest(gb, clk); err != nil {
+		return false, err
+	}
+	s.dropInputsAfter(clk.Cycle)
+	gb.CPU.Rewind.Unfetch(fetches - gb.Debug.Fetches)
+	return true, nil
+}
+
+// Restores the newest snapshot taken at or before the cycle, discarding newer ones.
+// If all snapshots are newer, the oldest one is restored.
+func (s *Snapshots) restore(gb *Gameboy, clk *ClockRT, cycle uint) error {
+	for s.n > 0 && s.cycle > cycle {
+		if err := s.pop(); err != nil {
+			return err
+		}
+	}
+	return s.restoreLatest(gb, clk)
+}
+
+// Discards the newest snapshot, making the one before it the newest
+func (s *Snapshots) pop() error {
+	idx := (s.start + s.n - 1) % len(s.deltas)
+	delta := s.deltas[idx]
+	prev, err := applyDelta(s.latest, delta)
+	if err != nil {
+		return err
+	}
+	s.deltas[idx] = snapshotDelta{}
+	s.n--
+	s.latest = prev
+	s.cycle = delta.Cycle
+	return nil
+}
+
+func (s *Snapshots) restoreLatest(gb *Gameboy, clk *ClockRT) error {
+	if err := decodeSnapshot(gb, s.latest); err != nil {
+		return err
+	}
+	clk.Cycle = s.cycle
+	clk.frameCount = gb.PPU.FrameCount
+	return nil
+}
+
+// Like a save state, but the debugger and execution log are left alone since rewinding shouldn't touch them.
+// Only the fetch count and call stack follow execution.
+func encodeSnapshot(gb *Gameboy) ([]byte, error) {
+	state := *gb
+	state.Cartridge.ROM = nil
+	state.Debug = Debug{Debugger: Debugger{Fetches: gb.Debug.Fetches, Calls: gb.Debug.Calls}}
+	state.CPU.Rewind = Rewind{}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&state); err != nil {
+		return nil, fmt.Errorf("encoding snapshot: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeSnapshot(gb *Gameboy, data []byte) error {
+	var state Gameboy
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		return fmt.Errorf("decoding snapshot: %w", err)
+	}
+	state.Cartridge.ROM = gb.Cartridge.ROM
+	fetches, calls := state.Debug.Fetches, state.Debug.Calls
+	state.Debug = gb.Debug
+	state.Debug.Fetches, state.Debug.Calls = fetches, calls
+	state.CPU.Rewind = gb.CPU.Rewind
+	*gb = state
+	gb.linkDebugViews()
+	return nil
+}
+
+// XOR of a and b, padded with zeros to the longest of them
+func xorBytes(a, b []byte) []byte {
+	out := make([]byte, max(len(a), len(b)))
+	copy(out, a)
+	for i, v := range b {
+		out[i] ^= v
+	}
+	return out
+}
+
+func compressDelta(older, newer []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(xorBytes(older, newer)); err != nil {
+		return nil, fmt.Errorf("compressing snapshot: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("compressing snapshot: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func applyDelta(newer []byte, delta snapshotDelta) ([]byte, error) {
+	xor, err := io.ReadAll(flate.NewReader(bytes.NewReader(delta.Data)))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing snapshot: %w", err)
+	}
+	return xorBytes(xor, newer)[:delta.Len], nil
+}
@@ -0,0 +1,196 @@
+package model
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Labels from an RGBDS .sym file as written by rgblink, one "bank:address name" per line:
+//
+//	; File generated by rgblink
+//	00:0150 EntryPoint
+//	00:0354 Input.onenibble
+//	01:4000 LevelData
+//
+// Local labels are stored with their full name, e.g. "Input.onenibble".
+type Symbols struct {
+	// Labels at each location, in file order
+	Labels map[SymbolAddr][]string
+	// Location of each label
+	Addresses map[string]SymbolAddr
+	// All locations with a label, in order
+	Sorted []SymbolAddr
+}
+
+type SymbolAddr struct {
+	Bank uint16
+	Addr Addr
+}
+
+// Implemented by *Gameboy to name addresses in the disassembly
+type Labeler interface {
+	Label(addr Addr) (string, bool)
+}
+
+func ParseSymbols(r io.Reader) (Symbols, error) {
+	syms := Symbols{
+		Labels:    map[SymbolAddr][]string{},
+		Addresses: map[string]SymbolAddr{},
+	}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), ";")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return syms, fmt.Errorf("line %d: expected 'bank:address name'", line)
+		}
+		bank, addr, ok := strings.Cut(fields[0], ":")
+		if !ok {
+			return syms, fmt.Errorf("line %d: expected 'bank:address', got '%s'", line, fields[0])
+		}
+		b, err := strconv.ParseUint(bank, 16, 16)
+		if err != nil {
+			return syms, fmt.Errorf("line %d: invalid bank '%s'", line, bank)
+		}
+		a, err := strconv.ParseUint(addr, 16, 16)
+		if err != nil {
+			return syms, fmt.Errorf("line %d: invalid address '%s'", line, addr)
+		}
+		sa := SymbolAddr{Bank: uint16(b), Addr: Addr(a)}
+		name := fields[1]
+		if _, ok := syms.Labels[sa]; !ok {
+			syms.Sorted = append(syms.Sorted, sa)
+		}
+		syms.Labels[sa] = append(syms.Labels[sa], name)
+		syms.Addresses[name] = sa
+	}
+	if err := scanner.Err(); err != nil {
+		return syms, err
+	}
+	slices.SortFunc(syms.Sorted, func(a, b SymbolAddr) int {
+		if a.Bank != b.Bank {
+			return int(a.Bank) - int(b.Bank)
+		}
+		return int(a.Addr) - int(b.Addr)
+	})
+	return syms, nil
+}
+
+func LoadSymbols(path string) (Symbols, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Symbols{}, err
+	}
+	defer f.Close()
+	syms, err := ParseSymbols(f)
+	if err != nil {
+		return syms, fmt.Errorf("%s: %w", path, err)
+	}
+	return syms, nil
+}
+
+// Path of the .sym file rgblink writes next to the ROM
+func SymbolsPath(romPath string) string {
+	if i := strings.LastIndexByte(romPath, '.'); i > strings.LastIndexAny(romPath, `/\`) {
+		romPath = romPath[:i]
+	}
+	return romPath + ".sym"
+}
+
+// Looks up a label by name, or a local label by its part after the dot if that is unambiguous
+func (s *Symbols) Lookup(name string) (SymbolAddr, bool) {
+	if sa, ok := s.Addresses[name]; ok {
+		return sa, true
+	}
+	var found []SymbolAddr
+	for full, sa := range s.Addresses {
+		if _, local, ok := strings.Cut(full, "."); ok && "."+local == name {
+			found = append(found, sa)
+		}
+	}
+	if len(found) == 1 {
+		return found[0], true
+	}
+	return SymbolAddr{}, false
+}
+
+// The last label at or before the location in the same bank, e.g. to show "Main+$0c"
+func (s *Symbols) Nearest(sa SymbolAddr) (SymbolAddr, bool) {
+	i, found := slices.BinarySearchFunc(s.Sorted, sa, func(a, b SymbolAddr) int {
+		if a.Bank != b.Bank {
+			return int(a.Bank) - int(b.Bank)
+		}
+		return int(a.Addr) - int(b.Addr)
+	})
+	if found {
+		return sa, true
+	}
+	if i == 0 || s.Sorted[i-1].Bank != sa.Bank {
+		return SymbolAddr{}, false
+	}
+	return s.Sorted[i-1], true
+}
+
+// Bank mapped in at addr: the selected ROM or cartridge RAM bank, or 0 for unbanked memory
+func (gb *Gameboy) bankAt(addr Addr) uint16 {
+	switch {
+	case addr <= AddrCartridgeBank0End:
+		return uint16(gb.Cartridge.SelectedROMBank0)
+	case addr <= AddrCartridgeBankNEnd:
+		return uint16(gb.Cartridge.SelectedROMBank1)
+	case addr >= AddrCartridgeRAMBegin && addr <= AddrCartridgeRAMEnd:
+		return uint16(gb.Cartridge.SelectedRAMBank)
+	}
+	return 0
+}
+
+// Label at addr in the currently mapped banks
+func (gb *Gameboy) Label(addr Addr) (string, bool) {
+	labels := gb.Debug.Symbols.Labels[SymbolAddr{Bank: gb.bankAt(addr), Addr: addr}]
+	if len(labels) == 0 {
+		return "", false
+	}
+	return labels[0], true
+}
+
+// Start of each memory region, labels in one region don't name addresses in the next
+var symbolRegions = []Addr{
+	AddrCartridgeBankNEnd + 1,
+	AddrVRAMBegin,
+	AddrCartridgeRAMBegin,
+	AddrWRAMBegin,
+	AddrEchoRAMBegin,
+	AddrOAMBegin,
+	AddrP1,
+	AddrHRAMBegin,
+}
+
+// Label with offset for addr in the currently mapped banks, e.g. "Main+$0c", or just the address
+func (gb *Gameboy) LabelOffset(addr Addr) string {
+	sa, ok := gb.Debug.Symbols.Nearest(SymbolAddr{Bank: gb.bankAt(addr), Addr: addr})
+	for _, begin := range symbolRegions {
+		if addr >= begin && sa.Addr < begin {
+			ok = false
+		}
+	}
+	if !ok {
+		return "$" + addr.Hex()
+	}
+	name := gb.Debug.Symbols.Labels[sa][0]
+	offset := addr - sa.Addr
+	if offset == 0 {
+		return name
+	}
+	if offset <= 0xff {
+		return fmt.Sprintf("%s+$%s", name, Data8(offset).Hex())
+	}
+	return fmt.Sprintf("%s+$%s", name, offset.Hex())
+}
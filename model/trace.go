@@ -0,0 +1,59 @@
+package model
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Writes the state right before the instruction at PC executes in the Gameboy Doctor log format
+// (https://github.com/robert/gameboy-doctor), e.g.
+//
+//	A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0100 PCMEM:00,C3,13,02
+//
+// Reference logs start at $0100 with the boot ROM skipped, and are made with LY stuck at $90 (see ConfigDebug.StubLY).
+func (gb *Gameboy) WriteTraceLine(w io.Writer) {
+	regs := &gb.CPU.Regs
+	pc := regs.PC
+	fmt.Fprintf(
+		w,
+		"A:%02X F:%02X B:%02X C:%02X D:%02X E:%02X H:%02X L:%02X SP:%04X PC:%04X PCMEM:%02X,%02X,%02X,%02X\n",
+		regs.A, regs.F, regs.B, regs.C, regs.D, regs.E, regs.H, regs.L, uint16(regs.SP), uint16(pc),
+		gb.ProbeAddress(pc), gb.ProbeAddress(pc+1), gb.ProbeAddress(pc+2), gb.ProbeAddress(pc+3),
+	)
+}
+
+// Starts writing a line per executed instruction to w (see WriteTraceLine), or stops if w is nil.
+// The trace is buffered, and flushed when the clock pauses or the trace is replaced.
+// Must be called from the clock's goroutine, or when the clock isn't running.
+func (clockRT *ClockRT) SetTrace(w io.Writer) error {
+	err := clockRT.flushTrace()
+	clockRT.trace = nil
+	if w != nil {
+		clockRT.trace = bufio.NewWriterSize(w, 1<<16)
+	}
+	return err
+}
+
+func (clockRT *ClockRT) flushTrace() error {
+	if clockRT.trace == nil {
+		return nil
+	}
+	return clockRT.trace.Flush()
+}
+
+// Called when the fetched instruction starts executing. PC is moved back to the instruction meanwhile.
+func (clockRT *ClockRT) onExecute(gb *Gameboy) {
+	if clockRT.trace == nil && len(clockRT.fetchListeners) == 0 {
+		return
+	}
+	pc := gb.CPU.Regs.PC
+	gb.CPU.Regs.PC = gb.CPU.FetchAddr
+	if clockRT.trace != nil {
+		gb.WriteTraceLine(clockRT.trace)
+	}
+	for _, f := range clockRT.fetchListeners {
+		f(gb)
+	}
+	gb.CPU.Regs.PC = pc
+}
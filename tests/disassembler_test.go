@@ -0,0 +1,72 @@
+package tests_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jonathangjertsen/toyboy/model"
+)
+
+func TestDisassembleROM(t *testing.T) {
+	for _, name := range []string{"empty.gb", "hello-world.gb", "unbricked.gb"} {
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(filepath.Join("..", "assets", "cartridges", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rom := model.Data8Slice(raw)
+			banks := model.DisassembleROM(rom)
+
+			// Every byte must be emitted exactly once, in order
+			var have []model.Data8
+			for bank, dis := range banks {
+				type piece struct {
+					addr model.Addr
+					raw  []model.Data8
+				}
+				var pieces []piece
+				for _, section := range dis.Code {
+					for _, di := range section.Instructions {
+						pieces = append(pieces, piece{di.Address, di.Raw[:di.Size()]})
+					}
+				}
+				for _, section := range dis.Data {
+					pieces = append(pieces, piece{section.Address, section.Raw})
+				}
+				slices.SortFunc(pieces, func(a, b piece) int { return int(a.addr) - int(b.addr) })
+				next := model.Addr(min(bank, 1) * model.ROMBankSize)
+				for _, p := range pieces {
+					if p.addr != next {
+						t.Fatalf("bank %d: gap or overlap at %s", bank, p.addr.Hex())
+					}
+					have = append(have, p.raw...)
+					next += model.Addr(len(p.raw))
+				}
+			}
+			if !slices.Equal(have, rom) {
+				t.Fatalf("disassembly doesn't cover the ROM")
+			}
+
+			var buf bytes.Buffer
+			if err := model.WriteRGBDS(&buf, banks); err != nil {
+				t.Fatal(err)
+			}
+			if name == "unbricked.gb" {
+				for _, want := range []string{
+					"SECTION \"ROM Bank $000\", ROM0[$0000]\n    ds 256, $00\n    jp Jump_000_0150\n",
+					"\nJump_000_0150:\n    ld a, [$ff44]\n    cp a, $90\n    jp c, Jump_000_0150\n",
+					"    call Call_000_0362\n",
+					"SECTION \"ROM Bank $001\", ROMX[$4000], BANK[$001]\n    ds 16384, $ff\n",
+				} {
+					if !strings.Contains(buf.String(), want) {
+						t.Errorf("missing %q", want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package tests_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/jonathangjertsen/toyboy/model"
+)
+
+func TestGDBStub(t *testing.T) {
+	gb, clk := newUnbrickedGameboy(t)
+	srv, err := model.ListenGDB("localhost:0", gb, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	clk.PauseAfterCycle.Add(1)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		fs := model.FrameSync{}
+		for {
+			select {
+			case <-srv.Killed():
+				return
+			default:
+			}
+			clk.MCycle(1024, gb, model.AudioSilent{}, &fs)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := gdbClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+
+	// unbricked.gb: JP $0150 at the entry point, then
+	// $0150 LD A, [$FF44] / CP $90 / JP C, $0150 / $0158 LD A, 0 / $015A LD [$FF40], A
+	for _, step := range []struct{ send, want string }{
+		{"?", "S05"},
+		{"p5", "ff00"}, // SkipBootROM pretends the boot ROM is still finishing its last instruction
+		{"qXfer:features:read:target.xml:0,1000", "l<?xml"},
+		{"Z0,158,1", "OK"},
+		{"c", "S05"},
+		{"p5", "5801"},
+		{"z0,158,1", "OK"},
+		{"s", "S05"},
+		{"p5", "5a01"},
+		{"Z2,ff40,1", "OK"},
+		{"c", "S05"},
+		{"p5", "5a01"}, // Stopped right after the write, before the instruction is done
+		{"z2,ff40,1", "OK"},
+		{"mff40,1", "00"},
+		{"Mc000,2:1234", "OK"},
+		{"mc000,2", "1234"},
+		{"P3=34c0", "OK"},
+		{"p3", "34c0"},
+	} {
+		if have := c.request(step.send); !strings.HasPrefix(have, step.want) {
+			t.Fatalf("%s: want %s, have %s", step.send, step.want, have)
+		}
+	}
+	if len(gb.Debug.Debugger.Breakpoints) != 0 {
+		t.Fatalf("breakpoints not removed")
+	}
+
+	// Interrupt while running
+	c.write("c")
+	c.conn.Write([]byte{0x03})
+	if have := c.reply(); have != "S02" {
+		t.Fatalf("interrupt: want S02, have %s", have)
+	}
+	c.write("k")
+	<-stopped
+}
+
+type gdbClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *gdbClient) write(pkt string) {
+	var sum byte
+	for i := range len(pkt) {
+		sum += pkt[i]
+	}
+	fmt.Fprintf(c.conn, "$%s#%02x", pkt, sum)
+}
+
+// Sends the packet and returns the reply
+func (c *gdbClient) request(pkt string) string {
+	c.t.Helper()
+	c.write(pkt)
+	return c.reply()
+}
+
+func (c *gdbClient) reply() string {
+	c.t.Helper()
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if b != '$' {
+			continue
+		}
+		reply, err := c.r.ReadString('#')
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		c.r.Discard(2)
+		c.conn.Write([]byte("+"))
+		return strings.TrimSuffix(reply, "#")
+	}
+}
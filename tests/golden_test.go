@@ -0,0 +1,121 @@
+package tests_test
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonathangjertsen/toyboy/model"
+	"github.com/jonathangjertsen/toyboy/tests"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "regenerate the golden frames in testdata/golden")
+
+type goldenInput struct {
+	Frame uint
+	State model.JoypadState
+}
+
+type goldenCase struct {
+	ROM    string
+	Frames uint
+
+	// Joypad state to apply from the given frame and onwards
+	Inputs []goldenInput
+}
+
+var goldenCases = []goldenCase{
+	{ROM: "hello-world.gb", Frames: 300},
+	{ROM: "empty.gb", Frames: 300},
+	{
+		ROM:    "unbricked.gb",
+		Frames: 400,
+		Inputs: []goldenInput{
+			{Frame: 200, State: model.JoypadState{Right: true}},
+			{Frame: 240, State: model.JoypadState{}},
+			{Frame: 300, State: model.JoypadState{Left: true}},
+			{Frame: 320, State: model.JoypadState{}},
+		},
+	},
+}
+
+func TestGoldenFrames(t *testing.T) {
+	for _, gc := range goldenCases {
+		t.Run(gc.ROM, func(t *testing.T) {
+			vp := runGolden(t, gc)
+			img := vp.Image(model.RGBA)
+
+			golden := filepath.Join("testdata", "golden", strings.TrimSuffix(gc.ROM, ".gb")+".png")
+			if *updateGolden {
+				if err := vp.SavePNG(golden, model.RGBA); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want := loadGolden(t, golden)
+			diff := 0
+			for i := range img.Pix {
+				if img.Pix[i] != want.Pix[i] {
+					diff++
+				}
+			}
+			if diff > 0 {
+				actual := strings.TrimSuffix(golden, ".png") + ".actual.png"
+				if err := vp.SavePNG(actual, model.RGBA); err != nil {
+					t.Fatal(err)
+				}
+				t.Fatalf("%d pixels differ from %s after %d frames, actual frame written to %s (rerun with -update-golden if the change is intended)", diff, golden, gc.Frames, actual)
+			}
+		})
+	}
+}
+
+func runGolden(t *testing.T, gc goldenCase) *model.ViewPort {
+	t.Helper()
+
+	audio, devnull := model.AudioStub()
+	defer close(devnull)
+
+	// Golden frames include the boot ROM
+	config := tests.NewConfig()
+	config.BootROM.Variant = model.DefaultConfig.BootROM.Variant
+	gb, clk := tests.NewGameboy(t, tests.CartridgePath(gc.ROM), config)
+
+	clk.AttachFrameListener(func(frame uint, vp *model.ViewPort) {
+		for _, in := range gc.Inputs {
+			if in.Frame == frame {
+				gb.Joypad.Apply(gb, in.State)
+			}
+		}
+	})
+
+	fs := model.FrameSync{Ch: make(chan func(*model.ViewPort), 1)}
+	for gb.PPU.FrameCount < gc.Frames {
+		clk.MCycle(1024, gb, audio, &fs)
+	}
+	return &gb.PPU.FBViewport
+}
+
+func loadGolden(t *testing.T, path string) *image.Paletted {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update-golden to create it)", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decoding %s: %v", path, err)
+	}
+	paletted, ok := img.(*image.Paletted)
+	if !ok || paletted.Bounds() != image.Rect(0, 0, 160, 144) {
+		t.Fatalf("%s is not a 160x144 paletted image", path)
+	}
+	return paletted
+}
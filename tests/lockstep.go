@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jonathangjertsen/toyboy/model"
+)
+
+// Maximum number of M-cycles between two instruction boundaries, e.g. while halted
+const lockstepMaxCycles = 1 << 20
+
+// Expected state at an instruction boundary, with PC at the instruction about to execute
+type TraceStep struct {
+	Line  int
+	State CPUState
+}
+
+// Reads a reference trace with one instruction per line, either in the Gameboy Doctor format
+//
+//	A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0100 PCMEM:00,C3,13,02
+//
+// or as a JSON CPUState, e.g. {"pc": 256, "sp": 65534, "a": 1, ..., "ram": [[49152, 0]]}.
+// PCMEM and RAM are compared as memory at the listed addresses, unknown Gameboy Doctor fields are ignored.
+func ReadTrace(r io.Reader) ([]TraceStep, error) {
+	var steps []TraceStep
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		state, err := ParseTraceLine(text)
+		if err != nil {
+			return steps, fmt.Errorf("line %d: %w", line, err)
+		}
+		steps = append(steps, TraceStep{Line: line, State: state})
+	}
+	return steps, scanner.Err()
+}
+
+func ReadTraceFile(path string) ([]TraceStep, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	steps, err := ReadTrace(f)
+	if err != nil {
+		return steps, fmt.Errorf("%s: %w", path, err)
+	}
+	return steps, nil
+}
+
+func ParseTraceLine(text string) (CPUState, error) {
+	var state CPUState
+	if strings.HasPrefix(text, "{") {
+		err := json.Unmarshal([]byte(text), &state)
+		return state, err
+	}
+	regs := map[string]*model.Data8{
+		"A": &state.A, "F": &state.F, "B": &state.B, "C": &state.C,
+		"D": &state.D, "E": &state.E, "H": &state.H, "L": &state.L,
+	}
+	hasPC := false
+	for _, field := range strings.Fields(text) {
+		key, value, ok := strings.Cut(field, ":")
+		if !ok {
+			return state, fmt.Errorf("expected 'KEY:VALUE', got '%s'", field)
+		}
+		switch key {
+		case "SP", "PC":
+			v, err := strconv.ParseUint(value, 16, 16)
+			if err != nil {
+				return state, fmt.Errorf("invalid %s '%s'", key, value)
+			}
+			if key == "SP" {
+				state.SP = model.Addr(v)
+			} else {
+				state.PC = model.Addr(v)
+				hasPC = true
+			}
+		case "PCMEM":
+			for i, b := range strings.Split(value, ",") {
+				v, err := strconv.ParseUint(b, 16, 8)
+				if err != nil {
+					return state, fmt.Errorf("invalid PCMEM byte '%s'", b)
+				}
+				state.RAM = append(state.RAM, RAMEntry{Addr: model.Addr(i), Val: model.Data8(v)})
+			}
+		default:
+			if reg, ok := regs[key]; ok {
+				v, err := strconv.ParseUint(value, 16, 8)
+				if err != nil {
+					return state, fmt.Errorf("invalid %s '%s'", key, value)
+				}
+				*reg = model.Data8(v)
+			}
+		}
+	}
+	if !hasPC {
+		return state, fmt.Errorf("missing PC")
+	}
+	// PCMEM is relative to PC
+	for i := range state.RAM {
+		state.RAM[i].Addr += state.PC
+	}
+	return state, nil
+}
+
+// Runs the Gameboy from its current state and compares it against each step of the reference trace
+// at every instruction boundary. At the first divergence, a side-by-side diff and the last executed
+// instructions are written to w and an error is returned.
+// Attaches a fetch listener to the clock, so use a fresh clock for each run.
+func Lockstep(gb *model.Gameboy, clk *model.ClockRT, steps []TraceStep, w io.Writer) error {
+	var have *CPUState
+	var want *CPUState
+	clk.AttachFetchListener(func(gb *model.Gameboy) {
+		if want == nil || have != nil {
+			return
+		}
+		have = TestCaseStateFromCPU(gb)
+		for _, entry := range want.RAM {
+			have.RAM = append(have.RAM, RAMEntry{Addr: entry.Addr, Val: gb.ProbeAddress(entry.Addr)})
+		}
+	})
+
+	audio, devnull := model.AudioStub()
+	defer close(devnull)
+	fs := model.FrameSync{Ch: make(chan func(*model.ViewPort), 1)}
+	for i, step := range steps {
+		want, have = &step.State, nil
+		for cycles := 0; have == nil; cycles++ {
+			if cycles == lockstepMaxCycles {
+				return fmt.Errorf("trace line %d: no instruction fetched in %d M-cycles", step.Line, cycles)
+			}
+			clk.MCycle(1, gb, audio, &fs)
+			clk.PauseAfterCycle.Store(0)
+		}
+		if diff, ok := have.Diff(want); !ok {
+			fmt.Fprintf(w, "Diverged at instruction %d (trace line %d)\n", i, step.Line)
+			fmt.Fprint(w, diff)
+			fmt.Fprintf(w, "Last executed instructions:\n")
+			gb.PrintRewindBuffer(w, false)
+			return fmt.Errorf("diverged from reference at trace line %d", step.Line)
+		}
+	}
+	return nil
+}
+
+// Side-by-side comparison of the registers and memory in want, and whether they all match
+func (have *CPUState) Diff(want *CPUState) (string, bool) {
+	var sb strings.Builder
+	ok := true
+	row := func(name, h, w string) {
+		mark := ""
+		if h != w {
+			mark = "  <--"
+			ok = false
+		}
+		fmt.Fprintf(&sb, "%-8s %-8s %-8s%s\n", name, h, w, mark)
+	}
+	fmt.Fprintf(&sb, "%-8s %-8s %-8s\n", "", "toyboy", "ref")
+	row("PC", have.PC.Hex(), want.PC.Hex())
+	row("SP", have.SP.Hex(), want.SP.Hex())
+	row("A", have.A.Hex(), want.A.Hex())
+	row("F", have.F.Hex(), want.F.Hex())
+	row("B", have.B.Hex(), want.B.Hex())
+	row("C", have.C.Hex(), want.C.Hex())
+	row("D", have.D.Hex(), want.D.Hex())
+	row("E", have.E.Hex(), want.E.Hex())
+	row("H", have.H.Hex(), want.H.Hex())
+	row("L", have.L.Hex(), want.L.Hex())
+	for i, entry := range want.RAM {
+		h := "??"
+		if i < len(have.RAM) && have.RAM[i].Addr == entry.Addr {
+			h = have.RAM[i].Val.Hex()
+		}
+		row("["+entry.Addr.Hex()+"]", h, entry.Val.Hex())
+	}
+	return sb.String(), ok
+}
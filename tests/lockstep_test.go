@@ -0,0 +1,90 @@
+package tests_test
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jonathangjertsen/toyboy/tests"
+)
+
+var (
+	lockstepROM   = flag.String("lockstep.rom", "", "ROM to run in lockstep with -lockstep.trace")
+	lockstepTrace = flag.String("lockstep.trace", "", "reference trace to compare against, starting at $0100 with the boot ROM skipped")
+	lockstepLY90  = flag.Bool("lockstep.ly90", false, "make LY read as $90, like the Gameboy Doctor reference logs")
+)
+
+func TestLockstep(t *testing.T) {
+	// Record a reference trace with toyboy itself
+	gb, clk := newUnbrickedGameboy(t)
+	var ref strings.Builder
+	clk.SetTrace(&ref)
+	tests.RunFrames(gb, clk, 2)
+	if err := clk.SetTrace(nil); err != nil {
+		t.Fatal(err)
+	}
+	steps, err := tests.ReadTrace(strings.NewReader(ref.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gb, clk = newUnbrickedGameboy(t)
+	var out strings.Builder
+	if err := tests.Lockstep(gb, clk, steps, &out); err != nil {
+		t.Fatalf("%v\n%s", err, out.String())
+	}
+
+	// Same trace with register A changed at the 1000th instruction
+	steps[999].State.A ^= 0xff
+	gb, clk = newUnbrickedGameboy(t)
+	out.Reset()
+	if err := tests.Lockstep(gb, clk, steps, &out); err == nil {
+		t.Fatalf("want divergence")
+	}
+	for _, want := range []string{"trace line 1000", "A        " + (steps[999].State.A ^ 0xff).Hex(), "<--", "Current: [PC=" + steps[999].State.PC.Hex()} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("want %q in output:\n%s", want, out.String())
+		}
+	}
+}
+
+// Reference for newInterruptGameboy: the NOP at $C004 is fetched while the interrupt is requested,
+// but only executes after the ISR
+const lockstepInterruptTrace = `A:00 F:00 B:00 C:00 D:00 E:00 H:00 L:00 SP:D000 PC:C000 PCMEM:3E,01,E0,0F
+A:01 F:00 B:00 C:00 D:00 E:00 H:00 L:00 SP:D000 PC:C002 PCMEM:E0,0F,00,00
+A:01 F:00 B:00 C:00 D:00 E:00 H:00 L:00 SP:CFFE PC:0040 PCMEM:0C,D9,00,00
+A:01 F:00 B:00 C:01 D:00 E:00 H:00 L:00 SP:CFFE PC:0041 PCMEM:D9,00,00,00
+A:01 F:00 B:00 C:01 D:00 E:00 H:00 L:00 SP:D000 PC:C004 PCMEM:00,00,00,00
+A:01 F:00 B:00 C:01 D:00 E:00 H:00 L:00 SP:D000 PC:C005 PCMEM:00,00,00,00
+`
+
+func TestLockstepInterrupt(t *testing.T) {
+	steps, err := tests.ReadTrace(strings.NewReader(lockstepInterruptTrace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gb, clk := newInterruptGameboy(t)
+	var out strings.Builder
+	if err := tests.Lockstep(gb, clk, steps, &out); err != nil {
+		t.Fatalf("%v\n%s", err, out.String())
+	}
+}
+
+// go test ./tests -run LockstepReference -lockstep.rom game.gb -lockstep.trace reference.log
+func TestLockstepReference(t *testing.T) {
+	if *lockstepROM == "" || *lockstepTrace == "" {
+		t.Skip("needs -lockstep.rom and -lockstep.trace")
+	}
+	steps, err := tests.ReadTraceFile(*lockstepTrace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := tests.NewConfig()
+	config.Debug.RewindSize = 64
+	config.Debug.StubLY = *lockstepLY90
+	gb, clk := tests.NewGameboy(t, *lockstepROM, config)
+	if err := tests.Lockstep(gb, clk, steps, os.Stdout); err != nil {
+		t.Fatal(err)
+	}
+}
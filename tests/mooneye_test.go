@@ -0,0 +1,38 @@
+package tests_test
+
+import (
+	"flag"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jonathangjertsen/toyboy/model"
+)
+
+var mooneyeDir = flag.String("mooneye", "testdata/mooneye", "directory to search for Mooneye acceptance test ROMs")
+
+func TestMooneyeROMs(t *testing.T) {
+	var passed atomic.Int32
+	roms := findTestROMs(t, *mooneyeDir)
+	t.Cleanup(func() {
+		t.Logf("%d/%d Mooneye tests passed", passed.Load(), len(roms))
+	})
+
+	for _, rom := range roms {
+		name, _ := filepath.Rel(*mooneyeDir, rom)
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			gb := runTestROM(t, rom, *testROMFrames, func(gb *model.Gameboy) {}, func(gb *model.Gameboy) bool {
+				return gb.Debug.Debugger.Mooneye != model.MooneyeResultNone
+			})
+			switch gb.Debug.Debugger.Mooneye {
+			case model.MooneyeResultPassed:
+				passed.Add(1)
+			case model.MooneyeResultFailed:
+				t.Fatalf("test ROM failed at PC=%s", gb.CPU.Regs.PC.Hex())
+			default:
+				t.Fatalf("no result after %d frames", *testROMFrames)
+			}
+		})
+	}
+}
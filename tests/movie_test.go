@@ -0,0 +1,61 @@
+package tests_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/jonathangjertsen/toyboy/model"
+	"github.com/jonathangjertsen/toyboy/tests"
+)
+
+func TestMoviePlayback(t *testing.T) {
+	const frames = 400
+	inputs := []goldenInput{
+		{Frame: 200, State: model.JoypadState{Right: true}},
+		{Frame: 240, State: model.JoypadState{}},
+		{Frame: 300, State: model.JoypadState{Left: true}},
+		{Frame: 320, State: model.JoypadState{}},
+	}
+
+	// Input given at the end of a frame is applied at the start of the next M-cycle
+	gb, clk := newUnbrickedGameboy(t)
+	movie := gb.NewMovieFromPowerOn(true, time.Time{})
+	clk.AttachInputListener(movie.Record)
+	clk.AttachFrameListener(func(frame uint, vp *model.ViewPort) {
+		for _, in := range inputs {
+			if in.Frame == frame {
+				clk.ScheduleInput(model.InputEvent{Cycle: clk.Cycle, State: in.State})
+			}
+		}
+	})
+	tests.RunFrames(gb, clk, frames)
+	want := gb.PPU.FBViewport
+	wantCycle := clk.Cycle
+
+	var buf bytes.Buffer
+	if err := movie.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	movie, err := model.DecodeMovie(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(movie.Inputs) != len(inputs) {
+		t.Fatalf("recorded %d inputs, want %d", len(movie.Inputs), len(inputs))
+	}
+
+	gb, clk = newUnbrickedGameboy(t)
+	if err := movie.Play(gb, clk); err != nil {
+		t.Fatal(err)
+	}
+	tests.RunFrames(gb, clk, frames)
+	if clk.Cycle != wantCycle || gb.PPU.FBViewport != want {
+		t.Fatalf("playback diverged from the recording")
+	}
+}
+
+func newUnbrickedGameboy(t *testing.T) (*model.Gameboy, *model.ClockRT) {
+	t.Helper()
+	return tests.NewGameboy(t, tests.CartridgePath("unbricked.gb"), tests.NewConfig())
+}
@@ -0,0 +1,138 @@
+package tests_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonathangjertsen/toyboy/model"
+)
+
+func TestRGBDSReassemble(t *testing.T) {
+	roms := map[string][]model.Data8{"banked": bankedROM()}
+	for _, name := range []string{"empty.gb", "hello-world.gb", "unbricked.gb"} {
+		raw, err := os.ReadFile(filepath.Join("..", "assets", "cartridges", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		roms[name] = model.Data8Slice(raw)
+	}
+	for name, rom := range roms {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := model.WriteRGBDS(&buf, model.DisassembleROM(rom)); err != nil {
+				t.Fatal(err)
+			}
+			if name == "banked" {
+				for _, want := range []string{
+					"\nCall_002_4000:\n    nop\n",
+					"    call nz, Call_002_4000\n",
+					"    ld hl, sp-16\n",
+					"    jp Jump_000_0150\n",
+					"\nJump_003_4200:\n    jr Jump_003_4200\n",
+					"    set 7, a\n",
+				} {
+					if !strings.Contains(buf.String(), want) {
+						t.Errorf("missing %q", want)
+					}
+				}
+			}
+			have := runRGBDS(t, buf.Bytes())
+			checkReassembled(t, model.Data8Slice(have), rom)
+		})
+	}
+}
+
+func checkReassembled(t *testing.T, have, want []model.Data8) {
+	t.Helper()
+	if len(have) != len(want) {
+		t.Fatalf("want %d bytes, have %d", len(want), len(have))
+	}
+	for i := range have {
+		if have[i] != want[i] {
+			t.Fatalf("bank %d offset $%04x: want $%s have $%s", i/model.ROMBankSize, i%model.ROMBankSize, want[i].Hex(), have[i].Hex())
+		}
+	}
+}
+
+// Assembles and links with rgbasm and rgblink, if they are installed
+func runRGBDS(t *testing.T, src []byte) []byte {
+	for _, tool := range []string{"rgbasm", "rgblink"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not found", tool)
+		}
+	}
+	dir := t.TempDir()
+	asm, obj, rom := filepath.Join(dir, "rom.asm"), filepath.Join(dir, "rom.o"), filepath.Join(dir, "rom.gb")
+	if err := os.WriteFile(asm, src, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"rgbasm", "-o", obj, asm}, {"rgblink", "-o", rom, obj}} {
+		if out, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			t.Fatalf("%s: %v\n%s", args[0], err, out)
+		}
+	}
+	data, err := os.ReadFile(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// MBC1 ROM with 4 banks. Bank 0 calls $4000, where bank 1 has data, bank 2 every opcode that continues
+// to the next instruction, and bank 3 every CB-prefixed opcode.
+func bankedROM() []model.Data8 {
+	rom := make([]model.Data8, 4*model.ROMBankSize)
+	for i := range rom {
+		rom[i] = 0xff
+	}
+	rom[0x0147] = 0x01
+	rom[0x0148] = 0x01
+	copy(rom[0x0100:], []model.Data8{0x00, 0xc3, 0x50, 0x01})
+	copy(rom[0x0150:], []model.Data8{0xcd, 0x00, 0x40, 0x18, 0xfb})
+
+	for i := range 64 {
+		rom[model.ROMBankSize+i] = model.Data8(i)
+	}
+
+	code := rom[2*model.ROMBankSize:]
+	for op := range 256 {
+		switch op {
+		case 0x10, 0x18, 0xc3, 0xc9, 0xcb, 0xcd, 0xd9, 0xe9,
+			0xd3, 0xdb, 0xdd, 0xe3, 0xe4, 0xeb, 0xec, 0xed, 0xf4, 0xfc, 0xfd:
+			continue
+		}
+		code[0] = model.Data8(op)
+		switch op {
+		case 0x20, 0x28, 0x30, 0x38:
+			code[1] = 0x00
+			code = code[2:]
+		case 0xe8, 0xf8:
+			code[1] = 0xf0
+			code = code[2:]
+		case 0x06, 0x0e, 0x16, 0x1e, 0x26, 0x2e, 0x36, 0x3e, 0xc6, 0xce, 0xd6, 0xde, 0xe6, 0xee, 0xf6, 0xfe, 0xe0, 0xf0:
+			code[1] = 0x12
+			code = code[2:]
+		case 0xc2, 0xca, 0xd2, 0xda, 0xc4, 0xcc, 0xd4, 0xdc:
+			code[1], code[2] = 0x00, 0x40
+			code = code[3:]
+		case 0x01, 0x11, 0x21, 0x31, 0x08, 0xea, 0xfa:
+			code[1], code[2] = 0x23, 0xc1
+			code = code[3:]
+		default:
+			code = code[1:]
+		}
+	}
+	copy(code, []model.Data8{0xc3, 0x50, 0x01})
+
+	code = rom[3*model.ROMBankSize:]
+	for op := range 256 {
+		code[0], code[1] = 0xcb, model.Data8(op)
+		code = code[2:]
+	}
+	copy(code, []model.Data8{0x18, 0xfe})
+	return rom
+}
@@ -0,0 +1,143 @@
+package tests_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonathangjertsen/toyboy/model"
+	"github.com/jonathangjertsen/toyboy/tests"
+)
+
+func TestSaveStateRoundTrip(t *testing.T) {
+	gb, clk := newUnbrickedGameboy(t)
+	tests.RunFrames(gb, clk, 100)
+	gb.Cartridge.BatteryPath = "/home/recorder/game.sav"
+	path := filepath.Join(t.TempDir(), "unbricked.ss1")
+	if err := gb.SaveState(path, clk); err != nil {
+		t.Fatal(err)
+	}
+	saved := clk.Cycle
+
+	tests.RunFrames(gb, clk, 150)
+	wantCycle, wantRegs, wantVP := clk.Cycle, gb.CPU.Regs, gb.PPU.FBViewport
+
+	// Breakpoints set after saving and the battery save path are kept when loading
+	gb.Cartridge.BatteryPath = "/home/player/game.sav"
+	bp, err := model.ParseBreakpoint("pc", "$0150", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bp.Enabled = false
+	if _, err := gb.Debug.Debugger.AddBreakpoint(bp); err != nil {
+		t.Fatal(err)
+	}
+	if err := gb.LoadState(path, clk); err != nil {
+		t.Fatal(err)
+	}
+	if clk.Cycle != saved || gb.PPU.FrameCount != 100 {
+		t.Fatalf("want cycle %d frame 100, have cycle %d frame %d", saved, clk.Cycle, gb.PPU.FrameCount)
+	}
+	if len(gb.Debug.Debugger.Breakpoints) != 1 {
+		t.Fatalf("want breakpoints kept, have %v", gb.Debug.Debugger.Breakpoints)
+	}
+	if gb.Cartridge.BatteryPath != "/home/player/game.sav" {
+		t.Fatalf("want battery save path kept, have %s", gb.Cartridge.BatteryPath)
+	}
+	if &gb.Debug.HRAM.Source[0] != &gb.Mem[model.AddrHRAMBegin] {
+		t.Fatalf("want memory views linked to the restored memory")
+	}
+
+	tests.RunFrames(gb, clk, 150)
+	if clk.Cycle != wantCycle || gb.CPU.Regs != wantRegs || gb.PPU.FBViewport != wantVP {
+		t.Fatalf("execution after loading diverged from the straight run")
+	}
+}
+
+func TestSaveStateHeader(t *testing.T) {
+	gb, clk := newUnbrickedGameboy(t)
+	tests.RunFrames(gb, clk, 10)
+	now := time.Unix(1_700_000_000, 0)
+	var buf bytes.Buffer
+	if err := gb.EncodeSaveState(&buf, clk.Cycle, now); err != nil {
+		t.Fatal(err)
+	}
+	hdr, err := model.DecodeSaveStateHeader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Version != model.SaveStateVersion || hdr.Title != gb.CartridgeTitle() || hdr.Cycle != clk.Cycle || !hdr.Timestamp.Equal(now) {
+		t.Fatalf("unexpected header %+v", hdr)
+	}
+	img, err := png.Decode(bytes.NewReader(hdr.Thumbnail))
+	if err != nil {
+		t.Fatalf("decoding thumbnail: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 160 || b.Dy() != 144 {
+		t.Fatalf("want 160x144 thumbnail, have %v", b)
+	}
+}
+
+func TestSaveStateOtherROM(t *testing.T) {
+	gb, clk := newUnbrickedGameboy(t)
+	tests.RunFrames(gb, clk, 10)
+	var buf bytes.Buffer
+	if err := gb.EncodeSaveState(&buf, clk.Cycle, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	other, otherClk := tests.NewGameboy(t, tests.CartridgePath("hello-world.gb"), tests.NewConfig())
+	tests.RunFrames(other, otherClk, 5)
+	regs := other.CPU.Regs
+	if _, err := other.DecodeSaveState(&buf); err == nil || !strings.Contains(err.Error(), "is loaded") {
+		t.Fatalf("want state for another ROM rejected, have %v", err)
+	}
+	if other.CPU.Regs != regs || other.PPU.FrameCount != 5 {
+		t.Fatalf("want state untouched after rejecting")
+	}
+}
+
+func TestSaveStateVersion(t *testing.T) {
+	gb, clk := newUnbrickedGameboy(t)
+	tests.RunFrames(gb, clk, 10)
+	var buf bytes.Buffer
+	if err := gb.EncodeSaveState(&buf, clk.Cycle, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	withVersion := func(version uint32) *bytes.Reader {
+		data := bytes.Clone(buf.Bytes())
+		binary.LittleEndian.PutUint32(data[8:], version)
+		return bytes.NewReader(data)
+	}
+
+	if _, err := gb.DecodeSaveState(withVersion(model.SaveStateVersion + 1)); err == nil {
+		t.Fatalf("want newer version rejected")
+	}
+	if _, err := gb.DecodeSaveState(withVersion(0)); err == nil {
+		t.Fatalf("want version without a migration rejected")
+	}
+
+	// Versions start at 1, so 0 is free for testing
+	model.RegisterSaveStateMigration(0, func(data []byte) ([]byte, error) {
+		var state model.Gameboy
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+			return nil, err
+		}
+		state.CPU.Regs.A = 0x5a
+		var out bytes.Buffer
+		err := gob.NewEncoder(&out).Encode(&state)
+		return out.Bytes(), err
+	})
+	hdr, err := gb.DecodeSaveState(withVersion(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Version != 0 || gb.CPU.Regs.A != 0x5a {
+		t.Fatalf("want migrated state, have version %d A=%s", hdr.Version, gb.CPU.Regs.A.Hex())
+	}
+}
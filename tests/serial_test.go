@@ -0,0 +1,44 @@
+package tests_test
+
+import (
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonathangjertsen/toyboy/model"
+)
+
+var (
+	testROMDir    = flag.String("testroms", "testdata/roms", "directory to search for test ROMs that report their result over serial")
+	testROMFrames = flag.Uint("testrom-frames", 60*120, "give up on a test ROM after this many frames")
+)
+
+// Blargg's test ROMs print one of these when they are done
+const (
+	serialPassed = "Passed"
+	serialFailed = "Failed"
+)
+
+func TestSerialROMs(t *testing.T) {
+	for _, rom := range findTestROMs(t, *testROMDir) {
+		name, _ := filepath.Rel(*testROMDir, rom)
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			gb := runTestROM(t, rom, *testROMFrames, func(gb *model.Gameboy) {
+				gb.Serial.Capture = true
+			}, func(gb *model.Gameboy) bool {
+				out := gb.SerialOutput()
+				return strings.Contains(out, serialPassed) || strings.Contains(out, serialFailed)
+			})
+			out := gb.SerialOutput()
+			switch {
+			case strings.Contains(out, serialPassed):
+			case strings.Contains(out, serialFailed):
+				t.Fatalf("test ROM failed:\n%s", out)
+			default:
+				t.Fatalf("no result after %d frames:\n%s", *testROMFrames, out)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package tests_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"slices"
 	"testing"
@@ -39,26 +40,26 @@ func Test(t *testing.T) {
 	}
 }
 
+// The CPU locks up on these, and SingleStepTests has no data for them. See TestUndefinedOpcodes.
+var undefinedOpcodes = []model.Opcode{
+	model.OpcodeUndefD3,
+	model.OpcodeUndefDB,
+	model.OpcodeUndefDD,
+	model.OpcodeUndefE3,
+	model.OpcodeUndefE4,
+	model.OpcodeUndefEB,
+	model.OpcodeUndefEC,
+	model.OpcodeUndefED,
+	model.OpcodeUndefF4,
+	model.OpcodeUndefFC,
+	model.OpcodeUndefFD,
+}
+
 func testOpcode(t *testing.T, opcodeRaw uint8, gb *model.Gameboy, audio model.Audio) {
 	t.Helper()
 	opcode := model.Opcode(opcodeRaw)
 
-	if slices.Contains([]model.Opcode{
-		model.OpcodeHALT,
-		model.OpcodeSTOP,
-		model.OpcodeUndefD3,
-		model.OpcodeUndefDB,
-		model.OpcodeUndefDD,
-		model.OpcodeUndefE3,
-		model.OpcodeUndefE4,
-		model.OpcodeUndefEB,
-		model.OpcodeUndefEC,
-		model.OpcodeUndefED,
-		model.OpcodeUndefF4,
-		model.OpcodeUndefFC,
-		model.OpcodeUndefFD,
-	}, opcode) {
-		// not implemented yet
+	if slices.Contains(undefinedOpcodes, opcode) {
 		return
 	}
 
@@ -80,3 +81,340 @@ func testCB(t *testing.T, cb uint8, gb *model.Gameboy, audio model.Audio) {
 		return
 	}
 }
+
+func TestUndefinedOpcodes(t *testing.T) {
+	audio, devnull := model.AudioStub()
+	defer close(devnull)
+
+	var gb model.Gameboy
+	gb.AllocMem()
+	for _, opcode := range undefinedOpcodes {
+		t.Run(opcode.String(), func(t *testing.T) {
+			state := tests.CPUState{
+				PC: 0xc000, SP: 0xdffe, A: 0x12, B: 0x34, F: 0xb0,
+				RAM: tests.RAM{{Addr: 0xc000, Val: model.Data8(opcode)}, {Addr: 0xc001, Val: 0x00}},
+			}
+			tc := tests.TestCase{
+				Name:    opcode.String(),
+				Initial: state,
+				// Nothing changes and PC stays right after the opcode, since the next one is never fetched
+				Final:  state,
+				Cycles: tests.Cycles{{RW: "---"}, {RW: "---"}, {RW: "---"}, {RW: "---"}},
+			}
+			tests.Run(t, []tests.TestCase{tc}, opcode, &gb, audio)
+		})
+	}
+}
+
+// A few SingleStepTests-style cases, so the bus checks also run without the SingleStepTests data
+func TestBusCycles(t *testing.T) {
+	audio, devnull := model.AudioStub()
+	defer close(devnull)
+
+	var tcs []tests.TestCase
+	if err := json.Unmarshal([]byte(`[
+		{
+			"name": "c5 PUSH BC",
+			"initial": {"pc": 49152, "sp": 53248, "b": 18, "c": 52, "ram": [[49152, 197], [49153, 0]]},
+			"final": {"pc": 49153, "sp": 53246, "b": 18, "c": 52, "ram": [[53247, 18], [53246, 52]]},
+			"cycles": [[null, null, "---"], [53247, 18, "-wm"], [53246, 52, "-wm"], [49153, 0, "r-m"]]
+		},
+		{
+			"name": "ff RST $38",
+			"initial": {"pc": 49152, "sp": 53248, "ram": [[49152, 255], [56, 0]]},
+			"final": {"pc": 56, "sp": 53246, "ram": [[53247, 192], [53246, 1]]},
+			"cycles": [[null, null, "---"], [53247, 192, "-wm"], [53246, 1, "-wm"], [56, 0, "r-m"]]
+		},
+		{
+			"name": "20 JR NZ, taken",
+			"initial": {"pc": 49152, "ram": [[49152, 32], [49153, 2], [49156, 0]]},
+			"final": {"pc": 49156},
+			"cycles": [[49153, 2, "r-m"], [null, null, "---"], [49156, 0, "r-m"]]
+		},
+		{
+			"name": "28 JR Z, not taken",
+			"initial": {"pc": 49152, "ram": [[49152, 40], [49153, 2], [49154, 0]]},
+			"final": {"pc": 49154},
+			"cycles": [[49153, 2, "r-m"], [49154, 0, "r-m"]]
+		},
+		{
+			"name": "36 LD [HL], n",
+			"initial": {"pc": 49152, "h": 208, "l": 16, "ram": [[49152, 54], [49153, 171], [49154, 0]]},
+			"final": {"pc": 49154, "h": 208, "l": 16, "ram": [[53264, 171]]},
+			"cycles": [[49153, 171, "r-m"], [53264, 171, "-wm"], [49154, 0, "r-m"]]
+		}
+	]`), &tcs); err != nil {
+		t.Fatal(err)
+	}
+	var gb model.Gameboy
+	gb.AllocMem()
+	for _, tc := range tcs {
+		t.Run(tc.Name, func(t *testing.T) {
+			tests.Run(t, []tests.TestCase{tc}, model.Opcode(tc.Initial.RAM[0].Val), &gb, audio)
+		})
+	}
+}
+
+// Runs program from $C000 in pure RAM with the VBlank interrupt enabled. The VBlank ISR is INC C / RETI.
+func newProgramGameboy(t *testing.T, program ...model.Data8) (*model.Gameboy, func(n int)) {
+	t.Helper()
+	audio, devnull := model.AudioStub()
+	t.Cleanup(func() { close(devnull) })
+	gb, clk := loadProgram(t, program...)
+	fs := model.FrameSync{}
+	return gb, func(n int) { clk.MCycle(n, gb, audio, &fs) }
+}
+
+// Sets up a Gameboy for newProgramGameboy, with the first opcode fetched
+func loadProgram(t *testing.T, program ...model.Data8) (*model.Gameboy, *model.ClockRT) {
+	t.Helper()
+	gb, clk := tests.NewGameboy(t, "", tests.NewConfig())
+	gb.PureRAM = true
+	copy(gb.Mem[0xc000:], program)
+	copy(gb.Mem[0x40:], []model.Data8{0x0c, 0xd9})
+	gb.Mem[model.AddrIE] = 0x01
+	gb.CPU.Regs.SP = 0xd000
+	gb.CPU.Regs.IR = model.Opcode(gb.Mem[0xc000])
+	gb.CPU.FetchAddr = 0xc000
+	gb.CPU.FetchPending = true
+	gb.CPU.Regs.PC = 0xc001
+	return gb, clk
+}
+
+func TestHalt(t *testing.T) {
+	const (
+		EI, DI, HALT, INCA, LDBn, INCB, JR = 0xfb, 0xf3, 0x76, 0x3c, 0x06, 0x04, 0x18
+	)
+
+	t.Run("IME=1", func(t *testing.T) {
+		gb, run := newProgramGameboy(t, EI, HALT, INCA, JR, 0xfe)
+		run(10)
+		if !gb.CPU.Halted || gb.CPU.Regs.A != 0 {
+			t.Fatalf("want halted before INC A")
+		}
+		gb.IRQSet(model.IntSourceVBlank)
+		// One M-cycle to leave HALT, then 5 to dispatch and fetch the ISR's first opcode
+		run(5)
+		if gb.CPU.Regs.PC == 0x41 {
+			t.Fatalf("ISR entered too early")
+		}
+		run(1)
+		if gb.CPU.Regs.PC != 0x41 {
+			t.Fatalf("want ISR entered after 6 M-cycles, have PC=%s", gb.CPU.Regs.PC.Hex())
+		}
+		run(20)
+		if gb.CPU.Regs.A != 1 || gb.CPU.Regs.C != 1 || gb.Mem[model.AddrIF] != 0 {
+			t.Fatalf("want ISR to return to INC A, have A=%d C=%d IF=%s", gb.CPU.Regs.A, gb.CPU.Regs.C, gb.Mem[model.AddrIF].Hex())
+		}
+	})
+
+	t.Run("IME=0", func(t *testing.T) {
+		gb, run := newProgramGameboy(t, DI, HALT, INCA, JR, 0xfe)
+		run(10)
+		if !gb.CPU.Halted {
+			t.Fatalf("want halted")
+		}
+		gb.IRQSet(model.IntSourceVBlank)
+		run(1)
+		if gb.CPU.Halted || gb.CPU.Regs.A != 0 {
+			t.Fatalf("want HALT to take an M-cycle to exit")
+		}
+		run(1)
+		if gb.CPU.Regs.A != 1 {
+			t.Fatalf("want INC A right after leaving HALT")
+		}
+		run(20)
+		if gb.CPU.Regs.A != 1 || gb.CPU.Regs.C != 0 || gb.Mem[model.AddrIF] != 0x01 {
+			t.Fatalf("want interrupt not serviced, have A=%d C=%d IF=%s", gb.CPU.Regs.A, gb.CPU.Regs.C, gb.Mem[model.AddrIF].Hex())
+		}
+	})
+
+	t.Run("IME=0 pending", func(t *testing.T) {
+		// HALT bug: LD B, $04 becomes LD B, $06 / INC B
+		gb, run := newProgramGameboy(t, DI, HALT, LDBn, INCB, JR, 0xfe)
+		gb.Mem[model.AddrIF] = 0x01
+		run(20)
+		if gb.CPU.Halted || gb.CPU.Regs.B != 7 || gb.CPU.Regs.C != 0 {
+			t.Fatalf("want HALT bug, have halted=%v B=%d C=%d", gb.CPU.Halted, gb.CPU.Regs.B, gb.CPU.Regs.C)
+		}
+	})
+
+	t.Run("IME=1 pending", func(t *testing.T) {
+		// The interrupt is requested right before HALT, so it's dispatched before HALT executes.
+		// The ISR returns to HALT, which then halts since the interrupt was serviced.
+		gb, run := newProgramGameboy(t, EI, 0x00, 0x21, 0x0f, 0xff, 0x36, 0x01, HALT, INCA, JR, 0xfe)
+		run(20)
+		if have := isrReturnAddress(gb); gb.CPU.Regs.C != 1 || have != 0xc007 {
+			t.Fatalf("want ISR to return to HALT at $C007, have C=%d return address %s", gb.CPU.Regs.C, have.Hex())
+		}
+		run(20)
+		if !gb.CPU.Halted || gb.CPU.Regs.A != 0 || gb.CPU.Regs.C != 1 {
+			t.Fatalf("want halted after the ISR, have halted=%v A=%d C=%d", gb.CPU.Halted, gb.CPU.Regs.A, gb.CPU.Regs.C)
+		}
+	})
+
+	t.Run("EI before HALT pending", func(t *testing.T) {
+		// The HALT bug makes the ISR return to the HALT, which then halts since the interrupt was serviced
+		gb, run := newProgramGameboy(t, EI, HALT, INCA, JR, 0xfe)
+		gb.Mem[model.AddrIF] = 0x01
+		run(30)
+		if !gb.CPU.Halted || gb.CPU.Regs.A != 0 || gb.CPU.Regs.C != 1 {
+			t.Fatalf("want ISR to return to HALT, have halted=%v A=%d C=%d", gb.CPU.Halted, gb.CPU.Regs.A, gb.CPU.Regs.C)
+		}
+	})
+}
+
+// Address the last ISR returned to, which is left on the stack below SP
+func isrReturnAddress(gb *model.Gameboy) model.Addr {
+	sp := gb.CPU.Regs.SP
+	return model.Addr(gb.Mem[sp-2]) | model.Addr(gb.Mem[sp-1])<<8
+}
+
+// Hand-written versions of the Mooneye EI, DI and dispatch timing tests, with an interrupt requested up front
+func TestInterruptTiming(t *testing.T) {
+	const (
+		EI, DI, HALT, NOP, INCA, INCB, JR = 0xfb, 0xf3, 0x76, 0x00, 0x3c, 0x04, 0x18
+	)
+	for _, tc := range []struct {
+		name    string
+		program []model.Data8
+		// Address of the instruction the ISR returns to
+		want model.Addr
+	}{
+		// ei_sequence: the second EI is the instruction after the first one, so IME is set when it's done
+		{name: "EI EI", program: []model.Data8{DI, EI, EI, INCA, JR, 0xfe}, want: 0xc003},
+		// rapid_di_ei: DI cancels a pending EI, so only the last EI enables interrupts
+		{name: "EI DI EI DI EI", program: []model.Data8{EI, DI, EI, DI, EI, NOP, INCA, JR, 0xfe}, want: 0xc006},
+		// di_timing: DI takes effect right away
+		{name: "EI DI", program: []model.Data8{DI, EI, DI, INCA, JR, 0xfe}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gb, run := newProgramGameboy(t, tc.program...)
+			gb.Mem[model.AddrIF] = 0x01
+			run(30)
+			if tc.want == 0 {
+				if gb.CPU.Regs.C != 0 {
+					t.Fatalf("want interrupt not serviced")
+				}
+				return
+			}
+			if have := isrReturnAddress(gb); gb.CPU.Regs.C != 1 || have != tc.want {
+				t.Fatalf("want ISR to return to %s, have C=%d return address %s", tc.want.Hex(), gb.CPU.Regs.C, have.Hex())
+			}
+		})
+	}
+
+	t.Run("HALT IME=0 EI", func(t *testing.T) {
+		// halt_ime0_ei: leaving HALT with IME=0, then EI / INC A run before the interrupt is serviced
+		gb, run := newProgramGameboy(t, DI, HALT, EI, INCA, INCB, JR, 0xfe)
+		run(10)
+		gb.IRQSet(model.IntSourceVBlank)
+		run(30)
+		if have := isrReturnAddress(gb); gb.CPU.Regs.C != 1 || have != 0xc004 {
+			t.Fatalf("want ISR to return to INC B, have C=%d return address %s", gb.CPU.Regs.C, have.Hex())
+		}
+	})
+
+	t.Run("IE overwritten by push", func(t *testing.T) {
+		// ie_push: with SP=$0000 the upper byte of PC goes to IE, which cancels the dispatch and jumps to $0000
+		gb, run := newProgramGameboy(t, EI, NOP, INCA, JR, 0xfe)
+		gb.CPU.Regs.SP = 0x0000
+		copy(gb.Mem[0x0000:], []model.Data8{INCB, JR, 0xfe})
+		gb.Mem[model.AddrIF] = 0x01
+		run(30)
+		if gb.CPU.Regs.B == 0 || gb.CPU.Regs.C != 0 || gb.Mem[model.AddrIF] != 0x01 || gb.Mem[model.AddrIE] != 0xc0 {
+			t.Fatalf("want jump to $0000 with the interrupt still requested, have B=%d C=%d IF=%s IE=%s",
+				gb.CPU.Regs.B, gb.CPU.Regs.C, gb.Mem[model.AddrIF].Hex(), gb.Mem[model.AddrIE].Hex())
+		}
+	})
+
+	t.Run("IE overwritten by push, lower byte", func(t *testing.T) {
+		// The lower byte is pushed after the interrupt has been chosen, so it doesn't cancel the dispatch
+		gb, run := newProgramGameboy(t, EI, NOP, INCA, JR, 0xfe)
+		gb.CPU.Regs.SP = 0x0001
+		gb.Mem[model.AddrIF] = 0x01
+		run(10)
+		if gb.CPU.Regs.C != 1 || gb.Mem[model.AddrIE] != 0x02 {
+			t.Fatalf("want interrupt serviced, have C=%d IE=%s", gb.CPU.Regs.C, gb.Mem[model.AddrIE].Hex())
+		}
+	})
+}
+
+func TestStop(t *testing.T) {
+	const (
+		STOP, INCA, JR = 0x10, 0x3c, 0x18
+	)
+	// INC A after STOP is skipped when STOP is 2 bytes long
+	program := []model.Data8{STOP, INCA, INCA, JR, 0xfe}
+	// P1 with the action buttons selected
+	const selectAction = 0x10
+
+	t.Run("no button", func(t *testing.T) {
+		gb, run := newProgramGameboy(t, program...)
+		gb.Mem[model.AddrP1] = selectAction
+		gb.Timer.DIV = 0x1234
+		run(100)
+		if !gb.CPU.Stopped || gb.CPU.Regs.A != 0 || gb.Timer.DIV != 0 {
+			t.Fatalf("want stopped with DIV reset, have stopped=%v A=%d DIV=%04x", gb.CPU.Stopped, gb.CPU.Regs.A, gb.Timer.DIV)
+		}
+		gb.Joypad.Apply(gb, model.JoypadState{A: true})
+		run(10)
+		if gb.CPU.Stopped || gb.CPU.Regs.A != 1 {
+			t.Fatalf("want 2-byte STOP left on button press, have stopped=%v A=%d", gb.CPU.Stopped, gb.CPU.Regs.A)
+		}
+	})
+
+	t.Run("no button, unselected button pressed", func(t *testing.T) {
+		gb, run := newProgramGameboy(t, program...)
+		gb.Mem[model.AddrP1] = selectAction
+		run(10)
+		gb.Joypad.Apply(gb, model.JoypadState{Up: true})
+		run(10)
+		if !gb.CPU.Stopped {
+			t.Fatalf("want stopped until a selected line goes low")
+		}
+	})
+
+	t.Run("no button, interrupt pending", func(t *testing.T) {
+		gb, run := newProgramGameboy(t, program...)
+		gb.Mem[model.AddrP1] = selectAction
+		gb.Mem[model.AddrIF] = 0x01
+		gb.Timer.DIV = 0x1234
+		run(100)
+		if !gb.CPU.Stopped || gb.Timer.DIV != 0 {
+			t.Fatalf("want stopped with DIV reset, have stopped=%v DIV=%04x", gb.CPU.Stopped, gb.Timer.DIV)
+		}
+		gb.Joypad.Apply(gb, model.JoypadState{A: true})
+		run(10)
+		if gb.CPU.Stopped || gb.CPU.Regs.A != 2 {
+			t.Fatalf("want 1-byte STOP left on button press, have stopped=%v A=%d", gb.CPU.Stopped, gb.CPU.Regs.A)
+		}
+	})
+
+	t.Run("button held", func(t *testing.T) {
+		gb, run := newProgramGameboy(t, program...)
+		gb.Mem[model.AddrP1] = selectAction
+		gb.Joypad.Apply(gb, model.JoypadState{A: true})
+		gb.Mem[model.AddrIF] = 0
+		run(10)
+		if gb.CPU.Stopped || !gb.CPU.Halted || gb.Timer.DIV == 0 {
+			t.Fatalf("want HALT mode without DIV reset, have stopped=%v halted=%v DIV=%04x", gb.CPU.Stopped, gb.CPU.Halted, gb.Timer.DIV)
+		}
+		gb.IRQSet(model.IntSourceVBlank)
+		run(10)
+		if gb.CPU.Halted || gb.CPU.Regs.A != 1 {
+			t.Fatalf("want 2-byte STOP left on interrupt, have halted=%v A=%d", gb.CPU.Halted, gb.CPU.Regs.A)
+		}
+	})
+
+	t.Run("button held, interrupt pending", func(t *testing.T) {
+		gb, run := newProgramGameboy(t, program...)
+		gb.Mem[model.AddrP1] = selectAction
+		gb.Joypad.Apply(gb, model.JoypadState{A: true})
+		gb.Mem[model.AddrIF] = 0x01
+		run(10)
+		if gb.CPU.Stopped || gb.CPU.Halted || gb.CPU.Regs.A != 2 || gb.Timer.DIV == 0 {
+			t.Fatalf("want 1-byte STOP acting as NOP, have stopped=%v halted=%v A=%d DIV=%04x", gb.CPU.Stopped, gb.CPU.Halted, gb.CPU.Regs.A, gb.Timer.DIV)
+		}
+	})
+}
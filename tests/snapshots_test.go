@@ -0,0 +1,265 @@
+package tests_test
+
+import (
+	"testing"
+
+	"github.com/jonathangjertsen/toyboy/model"
+	"github.com/jonathangjertsen/toyboy/tests"
+)
+
+// Frame 5 of unbricked ends at this cycle
+const frame5Cycle = 734536
+
+var snapshotInputs = []model.InputEvent{
+	{Cycle: 200_000, State: model.JoypadState{Right: true}},
+	{Cycle: 400_000, State: model.JoypadState{}},
+	{Cycle: frame5Cycle + 40, State: model.JoypadState{Left: true}},
+	{Cycle: 900_000, State: model.JoypadState{}},
+}
+
+// Unbricked with a snapshot taken every interval frames and the input recorded for replay, like in the app
+func newRewindGameboy(t *testing.T, capacity int, interval uint) (*model.Gameboy, *model.ClockRT, *model.Snapshots) {
+	t.Helper()
+	config := tests.NewConfig()
+	config.Debug.RewindSize = 1 << 16
+	gb, clk := tests.NewGameboy(t, tests.CartridgePath("unbricked.gb"), config)
+	snapshots := model.NewSnapshots(capacity, interval)
+	clk.AttachFrameListener(func(frame uint, vp *model.ViewPort) {
+		if err := snapshots.OnFrame(gb, clk, frame); err != nil {
+			t.Error(err)
+		}
+	})
+	clk.AttachInputListener(snapshots.RecordInput)
+	if err := snapshots.Take(gb, clk); err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range snapshotInputs {
+		clk.ScheduleInput(ev)
+	}
+	return gb, clk, snapshots
+}
+
+// Runs a fresh Gameboy with the same input to the cycle
+func straightRun(t *testing.T, cycle uint) (*model.Gameboy, *model.ClockRT) {
+	t.Helper()
+	config := tests.NewConfig()
+	config.Debug.RewindSize = 1 << 16
+	gb, clk := tests.NewGameboy(t, tests.CartridgePath("unbricked.gb"), config)
+	for _, ev := range snapshotInputs {
+		clk.ScheduleInput(ev)
+	}
+	runToCycle(gb, clk, cycle)
+	return gb, clk
+}
+
+func runToCycle(gb *model.Gameboy, clk *model.ClockRT, cycle uint) {
+	fs := model.FrameSync{}
+	if cycle > clk.Cycle {
+		clk.MCycle(int((cycle-clk.Cycle)/4), gb, model.AudioSilent{}, &fs)
+	}
+}
+
+func rewindEntries(rb *model.Rewind) []model.ExecLogEntry {
+	var entries []model.ExecLogEntry
+	for i := rb.Start(); i != rb.End(); i = rb.Next(i) {
+		entries = append(entries, *rb.At(i))
+	}
+	return entries
+}
+
+// Checks that the Gameboy is where a straight run to the same cycle would be
+func checkStraightRun(t *testing.T, gb *model.Gameboy, clk *model.ClockRT) {
+	t.Helper()
+	want, wantClk := straightRun(t, clk.Cycle)
+	if clk.Cycle != wantClk.Cycle || gb.CPU.Regs != want.CPU.Regs || gb.PPU.FBViewport != want.PPU.FBViewport || gb.Joypad != want.Joypad {
+		t.Fatalf("state at cycle %d differs from a straight run", clk.Cycle)
+	}
+	if gb.PPU.FrameCount != want.PPU.FrameCount || gb.Mem[0xc000] != want.Mem[0xc000] {
+		t.Fatalf("state at cycle %d differs from a straight run", clk.Cycle)
+	}
+
+	// What is left of the execution log matches the end of the straight run's log
+	have, wantLog := rewindEntries(&gb.CPU.Rewind), rewindEntries(&want.CPU.Rewind)
+	if len(have) > len(wantLog) {
+		t.Fatalf("want at most %d log entries, have %d", len(wantLog), len(have))
+	}
+	wantLog = wantLog[len(wantLog)-len(have):]
+	for i := range have {
+		// The branch result of the current instruction is not known yet in either log
+		if i < len(have)-1 && have[i] != wantLog[i] || have[i].Instruction != wantLog[i].Instruction {
+			t.Fatalf("log entry %d of %d: want %+v have %+v", i, len(have), wantLog[i], have[i])
+		}
+	}
+	if gb.Debug.Fetches != want.Debug.Fetches || len(gb.Debug.Calls) != len(want.Debug.Calls) {
+		t.Fatalf("want %d fetches and call depth %d, have %d and %d", want.Debug.Fetches, len(want.Debug.Calls), gb.Debug.Fetches, len(gb.Debug.Calls))
+	}
+}
+
+func TestReverseSideEffects(t *testing.T) {
+	gb, clk, snapshots := newRewindGameboy(t, 16, 1)
+	var frames, inputs int
+	clk.AttachFrameListener(func(frame uint, vp *model.ViewPort) { frames++ })
+	clk.AttachInputListener(func(ev model.InputEvent) { inputs++ })
+
+	runToCycle(gb, clk, 800_000+123*4)
+	nSnapshots, nFrames, nInputs := snapshots.Len(), frames, inputs
+
+	// Break on the current instruction, which is in the main loop
+	inst, _ := gb.CPU.CurrInstruction()
+	bp, err := model.ParseBreakpoint("pc", "$"+inst.Address.Hex(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bp.Ignore = 1000
+	if _, err := gb.Debug.Debugger.AddBreakpoint(bp); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := snapshots.ReverseContinue(gb, clk)
+	if err != nil || !ok {
+		t.Fatalf("want earlier breakpoint hit, have ok=%v err=%v", ok, err)
+	}
+	if snapshots.Len() != nSnapshots || frames != nFrames || inputs != nInputs {
+		t.Fatalf("want no snapshots, frame or input events while replaying")
+	}
+	if bp := gb.Debug.Debugger.Breakpoints[0]; bp.Hits != 0 {
+		t.Fatalf("want hits not counted while replaying, have %d", bp.Hits)
+	}
+	if have, _ := gb.CPU.CurrInstruction(); have.Address != inst.Address {
+		t.Fatalf("want stop at %s, have %s", inst.Address.Hex(), have.Address.Hex())
+	}
+	checkStraightRun(t, gb, clk)
+
+	// Queued input is still applied when running forward again
+	gb.Debug.Debugger.Breakpoints[0].Enabled = false
+	runToCycle(gb, clk, 1_000_000)
+	if inputs != nInputs+1 {
+		t.Fatalf("want the remaining input applied, have %d", inputs-nInputs)
+	}
+	checkStraightRun(t, gb, clk)
+}
+
+func TestStepBackFrames(t *testing.T) {
+	gb, clk, snapshots := newRewindGameboy(t, 16, 1)
+	runToCycle(gb, clk, 1_700_000)
+	for range 4 {
+		cycle, frame := clk.Cycle, gb.PPU.FrameCount
+		ok, err := snapshots.StepBack(gb, clk)
+		if err != nil || !ok {
+			t.Fatalf("want step back, have ok=%v err=%v", ok, err)
+		}
+		if clk.Cycle >= cycle || gb.PPU.FrameCount >= frame {
+			t.Fatalf("want earlier than cycle %d frame %d, have cycle %d frame %d", cycle, frame, clk.Cycle, gb.PPU.FrameCount)
+		}
+		checkStraightRun(t, gb, clk)
+	}
+}
+
+func TestStepBackInstruction(t *testing.T) {
+	gb, clk, snapshots := newRewindGameboy(t, 16, 1)
+
+	// Start a little after the snapshot at frame 5 and the input right after it,
+	// so stepping back replays the input and then crosses into the span before the snapshot
+	runToCycle(gb, clk, frame5Cycle+40*4)
+	if gb.PPU.FrameCount != 5 {
+		t.Fatalf("want frame 5, have %d", gb.PPU.FrameCount)
+	}
+
+	// The first step goes back to the fetch of the current instruction
+	if ok, err := snapshots.StepBackInstruction(gb, clk); err != nil || !ok {
+		t.Fatalf("want step back, have ok=%v err=%v", ok, err)
+	}
+	for range 50 {
+		fetches := gb.Debug.Fetches
+		ok, err := snapshots.StepBackInstruction(gb, clk)
+		if err != nil || !ok {
+			t.Fatalf("want step back, have ok=%v err=%v", ok, err)
+		}
+		if gb.Debug.Fetches != fetches-1 {
+			t.Fatalf("want one instruction back from %d fetches, have %d", fetches, gb.Debug.Fetches)
+		}
+		if clk.Cycle > frame5Cycle+40 && clk.Cycle < frame5Cycle+40*4 {
+			checkStraightRun(t, gb, clk)
+		}
+	}
+	if clk.Cycle >= frame5Cycle {
+		t.Fatalf("want stepped back past the snapshot, at cycle %d", clk.Cycle)
+	}
+	checkStraightRun(t, gb, clk)
+}
+
+func TestReverseContinue(t *testing.T) {
+	gb, clk, snapshots := newRewindGameboy(t, 16, 1)
+	runToCycle(gb, clk, 800_000+77*4)
+	inst, _ := gb.CPU.CurrInstruction()
+	bp, err := model.ParseBreakpoint("pc", "$"+inst.Address.Hex(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gb.Debug.Debugger.AddBreakpoint(bp); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each hit is before the previous one and where a forward run would have stopped
+	for range 3 {
+		cycle := clk.Cycle
+		ok, err := snapshots.ReverseContinue(gb, clk)
+		if err != nil || !ok {
+			t.Fatalf("want earlier breakpoint hit, have ok=%v err=%v", ok, err)
+		}
+		if clk.Cycle >= cycle {
+			t.Fatalf("want earlier than cycle %d, have %d", cycle, clk.Cycle)
+		}
+		if have, _ := gb.CPU.CurrInstruction(); have.Address != inst.Address {
+			t.Fatalf("want stop at %s, have %s", inst.Address.Hex(), have.Address.Hex())
+		}
+		checkStraightRun(t, gb, clk)
+	}
+
+	// Without a hit in the history, stops at the oldest snapshot
+	gb.Debug.Debugger.Breakpoints[0].Enabled = false
+	ok, err := snapshots.ReverseContinue(gb, clk)
+	if err != nil || ok {
+		t.Fatalf("want no breakpoint hit, have ok=%v err=%v", ok, err)
+	}
+	if clk.Cycle != 0 {
+		t.Fatalf("want stop at the oldest snapshot, have cycle %d", clk.Cycle)
+	}
+	checkStraightRun(t, gb, clk)
+}
+
+func TestSnapshotsEviction(t *testing.T) {
+	gb, clk, snapshots := newRewindGameboy(t, 4, 2)
+	runToCycle(gb, clk, 1_700_000)
+	if frame := gb.PPU.FrameCount; frame != 12 || snapshots.Len() != 5 {
+		t.Fatalf("want frame 12 with 5 snapshots, have frame %d with %d", frame, snapshots.Len())
+	}
+
+	// Replaying from the newer snapshots still applies the input that was recorded for them
+	inst, _ := gb.CPU.CurrInstruction()
+	bp, err := model.ParseBreakpoint("pc", "$"+inst.Address.Hex(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gb.Debug.Debugger.AddBreakpoint(bp); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := snapshots.ReverseContinue(gb, clk); err != nil || !ok {
+		t.Fatalf("want earlier breakpoint hit, have ok=%v err=%v", ok, err)
+	}
+	checkStraightRun(t, gb, clk)
+
+	// The oldest remaining snapshot is from frame 4, and there is nothing before it
+	gb.Debug.Debugger.Breakpoints[0].Enabled = false
+	if ok, err := snapshots.ReverseContinue(gb, clk); err != nil || ok {
+		t.Fatalf("want no breakpoint hit, have ok=%v err=%v", ok, err)
+	}
+	if gb.PPU.FrameCount != 4 || snapshots.Len() != 1 {
+		t.Fatalf("want the snapshot from frame 4 left, have frame %d with %d", gb.PPU.FrameCount, snapshots.Len())
+	}
+	checkStraightRun(t, gb, clk)
+	if ok, err := snapshots.StepBackInstruction(gb, clk); err != nil || ok {
+		t.Fatalf("want nothing before the oldest snapshot, have ok=%v err=%v", ok, err)
+	}
+	checkStraightRun(t, gb, clk)
+}
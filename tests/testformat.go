@@ -6,11 +6,54 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/jonathangjertsen/toyboy/model"
 )
 
+// Config for emulator-level tests: no boot ROM and a small rewind buffer
+func NewConfig() model.Config {
+	config := model.DefaultConfig
+	config.BootROM.Variant = "None"
+	config.Debug.RewindSize = 16
+	return config
+}
+
+// Path of a ROM in assets/cartridges
+func CartridgePath(name string) string {
+	return filepath.Join("..", "assets", "cartridges", name)
+}
+
+// Creates a Gameboy with the ROM at path inserted, or without a cartridge if path is "".
+// Without a boot ROM in the config, the cartridge starts at its entry point as if the boot ROM had run.
+func NewGameboy(t *testing.T, path string, config model.Config) (*model.Gameboy, *model.ClockRT) {
+	t.Helper()
+
+	clk := model.NewClock()
+	gb := &model.Gameboy{}
+	gb.AllocMem()
+	gb.Init(&config, clk)
+	if path == "" {
+		return gb, clk
+	}
+	if err := model.LoadROM(path, gb); err != nil {
+		t.Fatal(err)
+	}
+	if config.BootROM.Variant == "None" {
+		gb.SkipBootROM()
+	}
+	return gb, clk
+}
+
+// Runs until the PPU has produced the given number of frames, without audio
+func RunFrames(gb *model.Gameboy, clk *model.ClockRT, frames uint) {
+	fs := model.FrameSync{}
+	for gb.PPU.FrameCount < frames {
+		clk.MCycle(1024, gb, model.AudioSilent{}, &fs)
+	}
+}
+
 type RAMEntry struct {
 	Addr model.Addr
 	Val  model.Data8
@@ -73,11 +116,41 @@ func (c *Cycles) UnmarshalJSON(data []byte) error {
 func (cs Cycles) String() string {
 	out := ""
 	for _, c := range cs {
-		out += fmt.Sprintf("@%04x %02x %s\n", c.Addr, c.Val, c.RW)
+		out += c.String() + "\n"
 	}
 	return out
 }
 
+func (c Cycle) String() string {
+	return fmt.Sprintf("@%04x %02x %s", c.Addr, c.Val, c.RW)
+}
+
+// The pins are e.g. "r-m" for a memory read, "-wm" for a write and "---" for an M-cycle without any access
+func (c Cycle) Read() bool  { return len(c.RW) > 0 && c.RW[0] == 'r' }
+func (c Cycle) Write() bool { return len(c.RW) > 1 && c.RW[1] == 'w' }
+
+// Checks the bus accesses made during the M-cycle. The address bus is not checked when there is no access.
+func (c Cycle) Check(log []model.BusAccess) error {
+	have := make([]string, len(log))
+	for i, acc := range log {
+		rw := "r-m"
+		if acc.Write {
+			rw = "-wm"
+		}
+		have[i] = Cycle{Addr: uint16(acc.Addr), Val: uint8(acc.Value), RW: rw}.String()
+	}
+	if !c.Read() && !c.Write() {
+		if len(log) != 0 {
+			return fmt.Errorf("want no access, have %v", have)
+		}
+		return nil
+	}
+	if len(log) != 1 || log[0].Write != c.Write() || log[0].Addr != model.Addr(c.Addr) || log[0].Value != model.Data8(c.Val) {
+		return fmt.Errorf("want %s, have %v", c, have)
+	}
+	return nil
+}
+
 type CPUState struct {
 	PC  model.Addr  `json:"pc"`
 	SP  model.Addr  `json:"sp"`
@@ -216,14 +289,21 @@ func RunOne(t *testing.T, i int, tc TestCase, opcode model.Opcode, gb *model.Gam
 	gb.CPU.Regs.IR = model.Opcode(gb.Mem[tc.Initial.PC])
 	gb.CPU.Regs.PC++
 
-	clock.MCycle(len(tc.Cycles), gb, audio, &fs)
-
 	defer func() {
 		if t.Failed() {
 			gb.CPU.Dump(gb)
 		}
 	}()
 
+	gb.Debug.RecordBus = true
+	for c, cycle := range tc.Cycles {
+		gb.Debug.BusLog = gb.Debug.BusLog[:0]
+		clock.MCycle(1, gb, audio, &fs)
+		if err := cycle.Check(gb.Debug.BusLog); err != nil {
+			t.Fatalf("Test %d M-cycle %d: %v. Full test: %s", i, c+1, err, tc.String(gb))
+		}
+	}
+
 	if have, want := gb.CPU.Regs.A, tc.Final.A; have != want {
 		t.Fatalf("Test %d Register A have %s want %s. Full test: %s", i, have.Hex(), want.Hex(), tc.String(gb))
 	}
@@ -0,0 +1,54 @@
+package tests_test
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonathangjertsen/toyboy/model"
+	"github.com/jonathangjertsen/toyboy/tests"
+)
+
+// Finds all ROMs under dir, skipping the test if there are none
+func findTestROMs(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var roms []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".gb") {
+			roms = append(roms, path)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) || (err == nil && len(roms) == 0) {
+		t.Skipf("no test ROMs in %s", dir)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return roms
+}
+
+// Runs a test ROM from the post-boot state until done returns true or maxFrames have been emulated
+func runTestROM(t *testing.T, rom string, maxFrames uint, setup func(gb *model.Gameboy), done func(gb *model.Gameboy) bool) *model.Gameboy {
+	t.Helper()
+
+	audio, devnull := model.AudioStub()
+	defer close(devnull)
+
+	config := tests.NewConfig()
+	config.Debug.Disassembler.Enable = false
+	gb, clk := tests.NewGameboy(t, rom, config)
+	setup(gb)
+
+	fs := model.FrameSync{Ch: make(chan func(*model.ViewPort), 1)}
+	for gb.PPU.FrameCount < maxFrames && !done(gb) {
+		clk.MCycle(1024, gb, audio, &fs)
+	}
+	return gb
+}
@@ -0,0 +1,91 @@
+package tests_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jonathangjertsen/toyboy/model"
+	"github.com/jonathangjertsen/toyboy/tests"
+)
+
+func TestTrace(t *testing.T) {
+	gb, clk := newUnbrickedGameboy(t)
+	var buf strings.Builder
+	clk.SetTrace(&buf)
+	fs := model.FrameSync{}
+	clk.MCycle(64, gb, model.AudioSilent{}, &fs)
+	if err := clk.SetTrace(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// unbricked.gb: JP $0150 at the entry point, then $0150 LD A, [$FF44] / CP $90 / JP C, $0150
+	lines := strings.Split(buf.String(), "\n")
+	for i, want := range []string{
+		"A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0100 PCMEM:C3,50,01,00",
+		"A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0150 PCMEM:FA,44,FF,FE",
+		"A:00 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0153 PCMEM:FE,90,DA,50",
+		"A:00 F:50 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0155 PCMEM:DA,50,01,3E",
+	} {
+		if lines[i] != want {
+			t.Fatalf("line %d: want %q, have %q", i, want, lines[i])
+		}
+	}
+	clk.MCycle(64, gb, model.AudioSilent{}, &fs)
+	if strings.Count(buf.String(), "\n") != len(lines)-1 {
+		t.Fatalf("trace written after stopping")
+	}
+}
+
+func TestTraceStubLY(t *testing.T) {
+	config := tests.NewConfig()
+	config.Debug.StubLY = true
+	gb, clk := tests.NewGameboy(t, tests.CartridgePath("unbricked.gb"), config)
+	var buf strings.Builder
+	clk.SetTrace(&buf)
+	fs := model.FrameSync{}
+	clk.MCycle(16, gb, model.AudioSilent{}, &fs)
+	if err := clk.SetTrace(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading LY=$90 ends the wait for VBlank right away
+	lines := strings.Split(buf.String(), "\n")
+	for i, want := range []string{
+		"A:90 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0153 PCMEM:FE,90,DA,50",
+		"A:90 F:C0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0155 PCMEM:DA,50,01,3E",
+		"A:90 F:C0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0158",
+	} {
+		if !strings.HasPrefix(lines[i+2], want) {
+			t.Fatalf("line %d: want %q, have %q", i+2, want, lines[i+2])
+		}
+	}
+}
+
+// LD A, 1 / LDH [IF], A / NOPs with IME=1. The NOP fetched while requesting the interrupt
+// is discarded and only traced once it executes after the ISR.
+func newInterruptGameboy(t *testing.T) (*model.Gameboy, *model.ClockRT) {
+	t.Helper()
+	gb, clk := loadProgram(t, 0x3e, 0x01, 0xe0, 0x0f, 0x00, 0x00, 0x00)
+	gb.Interrupts.IME = true
+	return gb, clk
+}
+
+func TestTraceInterrupt(t *testing.T) {
+	gb, clk := newInterruptGameboy(t)
+	var buf strings.Builder
+	clk.SetTrace(&buf)
+	fs := model.FrameSync{}
+	clk.MCycle(20, gb, model.AudioSilent{}, &fs)
+	if err := clk.SetTrace(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var pcs []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		_, after, _ := strings.Cut(line, "PC:")
+		pcs = append(pcs, after[:4])
+	}
+	if have, want := strings.Join(pcs, " "), "C000 C002 0040 0041 C004 C005"; !strings.HasPrefix(have, want) {
+		t.Fatalf("want %s, have %s", want, have)
+	}
+}